@@ -12,6 +12,7 @@ package blast
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -75,10 +76,11 @@ type state struct {
 	// input state
 	reader  io.Reader // input function provided by user
 	left    int       // available input at in
-	in      []byte
+	in      []byte    // input currently being consumed
 	inIndex int
-	bitbuf  int  // bit buffer
-	bitcnt  uint // number of bits in bit buffer
+	buf     []byte // buffer for input taken from reader
+	bitbuf  int    // bit buffer
+	bitcnt  uint   // number of bits in bit buffer
 
 	// output state
 	writer io.Writer           // output function provided by user
@@ -87,6 +89,28 @@ type state struct {
 	out    [maxWindowSize]byte // output buffer and sliding window
 }
 
+/*
+ * Refill the input buffer from the reader once the available input at in has
+ * been used up.  Running out of input in the middle of a stream is an error,
+ * since a complete stream always ends with an end code.
+ */
+func load(s *state) error {
+	if s.reader == nil {
+		return ErrUnexpectedEOF
+	}
+	n, err := s.reader.Read(s.buf)
+	s.in = s.buf
+	s.inIndex = 0
+	s.left = n
+	if n == 0 {
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return ErrUnexpectedEOF
+	}
+	return nil
+}
+
 /*
  * Return need bits from the input stream.  This always leaves less than
  * eight bits in the buffer.  bits() works properly for need == 0.
@@ -105,14 +129,9 @@ func bits(s *state, need uint) (int, error) {
 	val = s.bitbuf
 	for s.bitcnt < need {
 		if s.left == 0 {
-			s.left, err = s.reader.Read(s.in)
-			s.inIndex = 0
-			if err != nil {
+			if err = load(s); err != nil {
 				return 0, err
 			}
-			if s.left == 0 {
-				return 0, ErrUnexpectedEOF
-			}
 		}
 		val |= int(uint(s.in[s.inIndex]) << s.bitcnt) // load eight bits
 		s.inIndex++
@@ -192,15 +211,9 @@ func decode(s *state, h *huffman) (int16, error) {
 			break
 		}
 		if s.left == 0 {
-			var err error
-			s.left, err = s.reader.Read(s.in)
-			s.inIndex = 0
-			if err != nil {
+			if err := load(s); err != nil {
 				return -1, err
 			}
-			if s.left == 0 {
-				return 0, ErrUnexpectedEOF
-			}
 		}
 		bitBuffer = int(s.in[s.inIndex])
 		s.inIndex++
@@ -354,7 +367,7 @@ func decompress(s *state) error {
 	var extra = []int8{ // extra bits for length codes
 		0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
 
-	// set up decoding tables (once--might not be thread-safe)
+	// set up decoding tables (built per stream, so streams can be decoded concurrently)
 	construct(&literalCode, literalBitLength)
 	construct(&lengthCode, lengthBitLength)
 	construct(&distanceCode, distanceBitLength)
@@ -475,38 +488,121 @@ func decompress(s *state) error {
 	return nil
 }
 
-func blast(r io.Reader, w io.Writer, left *uint) error {
+/*
+ * Decompress a single stream.  Input is taken from in first and then from r
+ * once in is used up, so r may be nil when the whole stream is in memory.
+ * The number of bytes left unused in the last input buffer is returned, which
+ * lets the caller find where the compressed stream ended.
+ */
+func blast(r io.Reader, w io.Writer, in []byte) (int, error) {
 	var s state // input/output state
 	// initialize input state
 	s.reader = r
-	if left != nil && *left != 0 {
-		s.left = int(*left)
-	} else {
-		s.left = 0
-	}
+	s.in = in
+	s.left = len(in)
+	s.inIndex = 0
 	s.bitbuf = 0
 	s.bitcnt = 0
-	s.in = make([]byte, 16384)
+	s.buf = make([]byte, 16384)
 	// initialize output state
 	s.writer = w
 	s.next = 0
 	s.first = true
 	err := decompress(&s)
 	if err != nil {
-		return err
-	}
-	// return unused input
-	if left != nil {
-		*left = uint(s.left)
+		return 0, err
 	}
 	// write any leftover output and update the error code if needed
 	if s.next != 0 {
 		_, err = s.writer.Write(s.out[:s.next])
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
-	return nil
+	// return unused input
+	return s.left, nil
+}
+
+// Decompress decompresses the DCL stream at the start of src and writes the
+// result to w. It returns the number of bytes of src used by the stream, so
+// any data following the stream starts at src[n:].
+func Decompress(w io.Writer, src []byte) (n int, err error) {
+	left, err := blast(nil, w, src)
+	if err != nil {
+		return 0, err
+	}
+	return len(src) - left, nil
+}
+
+// Scanner iterates over DCL streams stored back to back in a buffer.
+// Successive calls to Scan step through the streams, decompressing each one.
+//
+//	s := blast.NewScanner(data)
+//	for s.Scan() {
+//		fmt.Println(s.Offset(), s.Consumed(), len(s.Bytes()))
+//	}
+//	if err := s.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+type Scanner struct {
+	data     []byte
+	offset   int
+	consumed int
+	out      []byte
+	err      error
+}
+
+// NewScanner returns a Scanner reading the streams stored in data.
+func NewScanner(data []byte) *Scanner {
+	return &Scanner{data: data}
+}
+
+// Scan decompresses the next stream, which is then available through Bytes.
+// It returns false when all of the data has been used or an error occurred.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	s.offset += s.consumed
+	s.consumed = 0
+	s.out = nil
+	if s.offset >= len(s.data) {
+		return false
+	}
+	var writer bytes.Buffer
+	n, err := Decompress(&writer, s.data[s.offset:])
+	if err != nil {
+		s.err = fmt.Errorf("blast: stream at offset %d: %w", s.offset, err)
+		return false
+	}
+	s.consumed = n
+	s.out = writer.Bytes()
+	return true
+}
+
+// Bytes returns the decompressed data of the most recent stream.
+func (s *Scanner) Bytes() []byte {
+	return s.out
+}
+
+// Offset returns the offset in the buffer where the most recent stream starts.
+func (s *Scanner) Offset() int {
+	return s.offset
+}
+
+// Consumed returns the number of compressed bytes used by the most recent stream.
+func (s *Scanner) Consumed() int {
+	return s.consumed
+}
+
+// Remaining returns the data that has not been used by any stream yet.
+func (s *Scanner) Remaining() []byte {
+	return s.data[s.offset+s.consumed:]
+}
+
+// Err returns the first error encountered by the Scanner.
+func (s *Scanner) Err() error {
+	return s.err
 }
 
 type reader struct {
@@ -516,10 +612,12 @@ type reader struct {
 
 // NewReader creates a new ReadCloser.
 // Reads from the returned ReadCloser read and decompress data from r.
+// Input is read from r in chunks, so any data following the stream may be
+// consumed as well; use Decompress or a Scanner to find where a stream ends.
 // It is the caller's responsibility to call Close on the ReadCloser when done.
 func NewReader(r io.Reader) (io.ReadCloser, error) {
 	var writer bytes.Buffer
-	err := blast(r, &writer, nil)
+	_, err := blast(r, &writer, nil)
 	if err != nil {
 		return nil, err
 	}
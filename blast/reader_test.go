@@ -0,0 +1,152 @@
+package blast
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// The example stream from the description at the top of reader.go
+var exampleStream = []byte{0x00, 0x04, 0x82, 0x24, 0x25, 0x8f, 0x80, 0x7f}
+
+// encodeLiterals returns a stream that stores data as uncoded literals, with
+// no repeats, followed by the end code.
+func encodeLiterals(data []byte) []byte {
+	out := []byte{0, 4}
+	var bitbuf uint32
+	var bitcnt uint
+	put := func(value uint32, n uint) {
+		bitbuf |= value << bitcnt
+		bitcnt += n
+		for bitcnt >= 8 {
+			out = append(out, byte(bitbuf))
+			bitbuf >>= 8
+			bitcnt -= 8
+		}
+	}
+	for _, b := range data {
+		put(0, 1)
+		put(uint32(b), 8)
+	}
+	// Length symbol 15 has the 7 bit code 1111111, which is stored inverted,
+	// and 255 in its extra bits gives the end code 519
+	put(1, 1)
+	put(0, 7)
+	put(0xff, 8)
+	if bitcnt > 0 {
+		out = append(out, byte(bitbuf))
+	}
+	return out
+}
+
+func TestDecompress(t *testing.T) {
+	for _, test := range []struct {
+		src      []byte
+		expected string
+	}{
+		{exampleStream, "AIAIAIAIAIAIA"},
+		{encodeLiterals([]byte("hello block")), "hello block"},
+		{encodeLiterals(nil), ""},
+	} {
+		// The bytes after the stream are not used
+		src := append(append([]byte{}, test.src...), 0xde, 0xad)
+		var buf bytes.Buffer
+		n, err := Decompress(&buf, src)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expected, err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("stream is %q, expected %q", buf.String(), test.expected)
+		}
+		if n != len(test.src) {
+			t.Errorf("%q used %d bytes, expected %d", test.expected, n, len(test.src))
+		}
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	for _, test := range []struct {
+		src []byte
+		err error
+	}{
+		{exampleStream[:5], ErrUnexpectedEOF},
+		{nil, ErrUnexpectedEOF},
+		{[]byte{0x02, 0x04, 0x00}, ErrHeader},
+		{[]byte{0x00, 0x07, 0x00}, ErrDictionary},
+	} {
+		if _, err := Decompress(io.Discard, test.src); !errors.Is(err, test.err) {
+			t.Errorf("%x: error is %v, expected %v", test.src, err, test.err)
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	second := encodeLiterals([]byte("hello block"))
+	trailing := []byte{0xde, 0xad}
+	var data []byte
+	data = append(data, exampleStream...)
+	data = append(data, second...)
+	data = append(data, trailing...)
+
+	s := NewScanner(data)
+	for _, expected := range []struct {
+		text     string
+		offset   int
+		consumed int
+	}{
+		{"AIAIAIAIAIAIA", 0, len(exampleStream)},
+		{"hello block", len(exampleStream), len(second)},
+	} {
+		if !s.Scan() {
+			t.Fatalf("scan of %q failed: %v", expected.text, s.Err())
+		}
+		if string(s.Bytes()) != expected.text || s.Offset() != expected.offset || s.Consumed() != expected.consumed {
+			t.Errorf("stream is %q at %d using %d bytes, expected %q at %d using %d bytes",
+				s.Bytes(), s.Offset(), s.Consumed(), expected.text, expected.offset, expected.consumed)
+		}
+	}
+	if remaining := s.Remaining(); !bytes.Equal(remaining, trailing) {
+		t.Errorf("remaining data is %x, expected %x", remaining, trailing)
+	}
+
+	// The trailing bytes aren't a stream
+	if s.Scan() {
+		t.Fatal("the trailing bytes were read as a stream")
+	}
+	if !errors.Is(s.Err(), ErrHeader) || s.Offset() != len(data)-len(trailing) {
+		t.Errorf("error is %v at offset %d", s.Err(), s.Offset())
+	}
+	if remaining := s.Remaining(); !bytes.Equal(remaining, trailing) {
+		t.Errorf("remaining data after the error is %x, expected %x", remaining, trailing)
+	}
+	if s.Scan() {
+		t.Error("scan continued after an error")
+	}
+}
+
+func TestScannerTruncated(t *testing.T) {
+	data := append(append([]byte{}, exampleStream...), exampleStream[:6]...)
+	s := NewScanner(data)
+	streams := 0
+	for s.Scan() {
+		streams++
+	}
+	if streams != 1 {
+		t.Errorf("found %d streams, expected 1", streams)
+	}
+	if !errors.Is(s.Err(), ErrUnexpectedEOF) || s.Offset() != len(exampleStream) {
+		t.Errorf("error is %v at offset %d, expected an unexpected EOF at %d", s.Err(), s.Offset(), len(exampleStream))
+	}
+	if s.Bytes() != nil || s.Consumed() != 0 {
+		t.Errorf("truncated stream returned %q using %d bytes", s.Bytes(), s.Consumed())
+	}
+
+	// All of the data was used
+	s = NewScanner(exampleStream)
+	for s.Scan() {
+	}
+	if s.Err() != nil || len(s.Remaining()) != 0 {
+		t.Errorf("error is %v with %x remaining", s.Err(), s.Remaining())
+	}
+}
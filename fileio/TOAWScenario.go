@@ -1,15 +1,15 @@
 package fileio
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
 	"os"
-
-	"github.com/samuelyuan/TOAWMap/blast"
 )
 
 type TOAWMapHeader struct {
@@ -74,13 +74,16 @@ type TeamNameData struct {
 }
 
 type TOAWMapData struct {
+	Header          *TOAWMapHeader `json:"-"`
 	Version         int
 	AllLocationData []LocationData
 	AllTeamNameData []*TeamNameData
-	AllTileData     [][]*TileData
+	AllTileData     *TileGrid
 	AllUnitData     []*UnitData
 	MapWidth        int
 	MapHeight       int
+	// CodePage is the code page of the text fields. Empty is Windows-1252.
+	CodePage CodePage `json:"-"`
 }
 
 func dumpData(inputData []byte, outputFilename string) {
@@ -98,12 +101,31 @@ func dumpData(inputData []byte, outputFilename string) {
 }
 
 func ReadTOAWScenario(filename string) (*TOAWMapData, error) {
+	return ReadTOAWScenarioWithOptions(filename, ReadOptions{})
+}
+
+// ReadTOAWScenarioWithOptions reads a scenario file, decoding only the sections
+// selected in opts. The compressed blocks of older games are decompressed in parallel.
+func ReadTOAWScenarioWithOptions(filename string, opts ReadOptions) (*TOAWMapData, error) {
+	return ReadTOAWScenarioContext(context.Background(), filename, opts)
+}
+
+// ReadTOAWScenarioContext is like ReadTOAWScenarioWithOptions, but stops reading and
+// returns the context's error as soon as ctx is cancelled.
+func ReadTOAWScenarioContext(ctx context.Context, filename string, opts ReadOptions) (*TOAWMapData, error) {
 	inputFile, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
 	}
 	defer inputFile.Close()
 
+	fi, err := inputFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	input := &contextReader{ctx: ctx, reader: inputFile}
+	progress := &progressReporter{fn: opts.Progress, warn: opts.Warning, input: input, totalBytes: fi.Size()}
+
 	// If the game is a TOAW4 scenario, it will be compressed using Gzip
 	// The older games will have TOAC in the header
 	var gzipHeader [3]byte
@@ -115,15 +137,10 @@ func ReadTOAWScenario(filename string) (*TOAWMapData, error) {
 	inputFile.Seek(0, 0)
 	// Gzip header: The magic number is 0x1f8band the compression method is 08 for DEFLATE
 	if gzipHeader[0] == 0x1f && gzipHeader[1] == 0x8b && gzipHeader[2] == 0x08 {
-		return ReadTOAW4Scenario(inputFile)
+		return readTOAW4Scenario(ctx, input, opts, progress)
 	}
 
-	fi, err := inputFile.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
-	}
-	fileLength := fi.Size()
-	streamReader := io.NewSectionReader(inputFile, int64(0), fileLength)
+	streamReader := bufio.NewReader(input)
 
 	mapHeader := TOAWMapHeader{}
 	if err := binary.Read(streamReader, binary.LittleEndian, &mapHeader); err != nil {
@@ -131,41 +148,8 @@ func ReadTOAWScenario(filename string) (*TOAWMapData, error) {
 	}
 
 	fmt.Println("Map Information:")
-	fmt.Printf("  Version: %d\n", mapHeader.Version)
-	fmt.Printf("  Title: %s\n", string(bytes.Trim(mapHeader.MapTitle[:], "\x00")))
-	
-	description := string(bytes.Trim(mapHeader.MapDescription[:], "\x00"))
-	if description != "" {
-		fmt.Printf("  Description: %s\n", description)
-	}
-	
-	// Only show victory messages if they're not empty
-	msg1 := string(bytes.Trim(mapHeader.EndMessageTeam1Victory1[:], "\x00"))
-	msg2 := string(bytes.Trim(mapHeader.EndMessageTeam1Victory2[:], "\x00"))
-	draw1 := string(bytes.Trim(mapHeader.EndMessageDraw1[:], "\x00"))
-	msg3 := string(bytes.Trim(mapHeader.EndMessageTeam2Victory[:], "\x00"))
-	draw2 := string(bytes.Trim(mapHeader.EndMessageDraw2[:], "\x00"))
-	
-	if msg1 != "" || msg2 != "" || draw1 != "" || msg3 != "" || draw2 != "" {
-		fmt.Println("Victory Messages:")
-		if msg1 != "" {
-			fmt.Printf("  Team 1 Victory 1: %s\n", msg1)
-		}
-		if msg2 != "" {
-			fmt.Printf("  Team 1 Victory 2: %s\n", msg2)
-		}
-		if draw1 != "" {
-			fmt.Printf("  Draw Message 1: %s\n", draw1)
-		}
-		if msg3 != "" {
-			fmt.Printf("  Team 2 Victory: %s\n", msg3)
-		}
-		if draw2 != "" {
-			fmt.Printf("  Draw Message 2: %s\n", draw2)
-		}
-	}
-	
-	fmt.Printf("Team goes first: %d\n", mapHeader.TeamGoesFirst)
+	printMapHeader(&mapHeader, opts.codePage())
+	progress.report(PhaseHeader, -1)
 
 	totalBlocks := 12
 	// Later version has an additional block
@@ -173,34 +157,10 @@ func ReadTOAWScenario(filename string) (*TOAWMapData, error) {
 		totalBlocks = 13
 	}
 
-	decompressedBlocks := make([][]byte, totalBlocks)
-	for i := 0; i < totalBlocks; i++ {
-		blockSize := uint32(0)
-		if err := binary.Read(streamReader, binary.LittleEndian, &blockSize); err != nil {
-			return nil, err
-		}
-		fmt.Printf("Block %d: %d bytes\n", i, blockSize)
-
-		blockData := make([]byte, blockSize)
-		if err := binary.Read(streamReader, binary.LittleEndian, &blockData); err != nil {
-			return nil, err
-		}
-
-		// The blocks stored in this file are compressed using PKWare Compression Library
-		// Decompress data
-		b := bytes.NewReader(blockData)
-		r, err := blast.NewReader(b)
-		if err != nil {
-			return nil, err
-		}
-
-		decompressedData, err := io.ReadAll(r)
-		if err != nil {
-			return nil, err
-		}
-		// dumpData(decompressedData, fmt.Sprintf("block%v.txt", i))
-		decompressedBlocks[i] = decompressedData
-		r.Close()
+	// Find the block boundaries first, since each block can be decompressed independently
+	compressedBlocks, err := readCompressedBlocks(streamReader, totalBlocks, progress)
+	if err != nil {
+		return nil, err
 	}
 
 	unknownData1 := make([]byte, 256)
@@ -227,63 +187,200 @@ func ReadTOAWScenario(filename string) (*TOAWMapData, error) {
 	version := int(mapHeader.Version)
 	mapWidth := 1 + int(binary.LittleEndian.Uint32(unknownData1[0:4]))
 	mapHeight := 1 + int(binary.LittleEndian.Uint32(unknownData1[4:8]))
-	
+
 	fmt.Printf("Map Dimensions: %dx%d\n", mapWidth, mapHeight)
 
-	locationBlockIndex := 10
-	if version >= 0x79 {
-		locationBlockIndex = 11
+	decompressedBlocks, err := decompressBlocks(ctx, compressedBlocks, neededBlocks(version, opts), opts.workers(), progress)
+	if err != nil {
+		return nil, err
 	}
-	locationBlock := decompressedBlocks[locationBlockIndex]
 
 	mapData := &TOAWMapData{
 		Version:         version,
-		AllTileData:     GetTileData(decompressedBlocks[1], mapHeight, mapWidth),
-		AllLocationData: GetLocationData(locationBlock),
-		AllUnitData:     GetUnitData(decompressedBlocks),
-		AllTeamNameData: GetTeamNameData(decompressedBlocks),
+		AllLocationData: []LocationData{},
+		AllTeamNameData: []*TeamNameData{},
+		AllUnitData:     []*UnitData{},
 		MapWidth:        mapWidth,
 		MapHeight:       mapHeight,
+		CodePage:        opts.codePage(),
+	}
+	if opts.wants(SectionHeader) {
+		mapData.Header = &mapHeader
+	}
+	if opts.wants(SectionTiles) {
+		mapData.AllTileData, err = getTileData(ctx, decompressedBlocks[1], mapHeight, mapWidth, progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.wants(SectionUnits) {
+		mapData.AllUnitData = GetUnitData(decompressedBlocks)
+	}
+	if opts.wants(SectionTeams) {
+		mapData.AllTeamNameData = GetTeamNameData(decompressedBlocks)
+	}
+	if opts.wants(SectionLocations) {
+		mapData.AllLocationData = GetLocationData(decompressedBlocks[locationBlockIndex(version)])
 	}
+	progress.report(PhaseDone, -1)
 	return mapData, nil
 }
 
 func ReadTOAW4Scenario(compressedFile *os.File) (*TOAWMapData, error) {
+	return ReadTOAW4ScenarioWithOptions(compressedFile, ReadOptions{})
+}
+
+// Offsets in the decompressed TOAW4 file. The sections are a constant size,
+// so they always start at the same place.
+const (
+	toaw4TileBlockOffset     = 67012
+	toaw4MaxMapSize          = 700
+	toaw4TileDataSize        = 48
+	toaw4LocationBlockOffset = 64859168
+	// 36 bytes per location * 4000 locations maximum
+	toaw4LocationBlockSize = 144000
+)
+
+// ReadTOAW4ScenarioWithOptions decodes a gzip compressed TOAW4 scenario in a single pass.
+// Only the sections selected in opts are kept and everything else is discarded while
+// streaming, so the decompressed file is never held in memory.
+func ReadTOAW4ScenarioWithOptions(compressedFile io.Reader, opts ReadOptions) (*TOAWMapData, error) {
+	return ReadTOAW4ScenarioContext(context.Background(), compressedFile, opts)
+}
+
+// ReadTOAW4ScenarioContext is like ReadTOAW4ScenarioWithOptions, but stops reading and
+// returns the context's error as soon as ctx is cancelled.
+func ReadTOAW4ScenarioContext(ctx context.Context, compressedFile io.Reader, opts ReadOptions) (*TOAWMapData, error) {
+	input := &contextReader{ctx: ctx, reader: compressedFile}
+	progress := &progressReporter{fn: opts.Progress, warn: opts.Warning, input: input}
+	return readTOAW4Scenario(ctx, input, opts, progress)
+}
+
+func readTOAW4Scenario(ctx context.Context, compressedFile io.Reader, opts ReadOptions, progress *progressReporter) (*TOAWMapData, error) {
 	decompressedFile, err := gzip.NewReader(compressedFile)
 	if err != nil {
 		return nil, err
 	}
 	defer decompressedFile.Close()
 
-	decompressedFileContents, err := io.ReadAll(decompressedFile)
-	if err != nil {
-		return nil, err
-	}
-
-	fmt.Println("Decompressed contents size: ", len(decompressedFileContents))
-	streamReader := io.NewSectionReader(bytes.NewReader(decompressedFileContents), int64(0), int64(len(decompressedFileContents)))
+	streamReader := &offsetReader{reader: bufio.NewReaderSize(decompressedFile, 1<<16)}
 
 	mapHeader := TOAWMapHeader{}
 	if err := binary.Read(streamReader, binary.LittleEndian, &mapHeader); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to read map header: %w", err)
 	}
 
 	fmt.Println("Map Information (TOAW4):")
+	printMapHeader(&mapHeader, opts.codePage())
+	progress.report(PhaseHeader, -1)
+
+	unknownData1 := make([]byte, 448)
+	if _, err := io.ReadFull(streamReader, unknownData1); err != nil {
+		return nil, err
+	}
+	fmt.Println("unknownData1:", unknownData1)
+
+	version := int(mapHeader.Version)
+	mapWidth := 1 + int(binary.LittleEndian.Uint32(unknownData1[132:136]))
+	mapHeight := 1 + int(binary.LittleEndian.Uint32(unknownData1[136:140]))
+
+	fmt.Printf("Map Dimensions: %dx%d\n", mapWidth, mapHeight)
+	if mapWidth > toaw4MaxMapSize || mapHeight > toaw4MaxMapSize {
+		return nil, fmt.Errorf("map dimensions %dx%d are larger than %dx%d", mapWidth, mapHeight, toaw4MaxMapSize, toaw4MaxMapSize)
+	}
+
+	mapData := &TOAWMapData{
+		Version:         version,
+		AllLocationData: []LocationData{},
+		AllUnitData:     []*UnitData{},
+		AllTeamNameData: []*TeamNameData{},
+		MapWidth:        mapWidth,
+		MapHeight:       mapHeight,
+		CodePage:        opts.codePage(),
+	}
+	if opts.wants(SectionHeader) {
+		mapData.Header = &mapHeader
+	}
+
+	// The block before the map data is similar to TOAW3 and is skipped
+	if opts.wants(SectionTiles) {
+		if err := streamReader.skipTo(toaw4TileBlockOffset); err != nil {
+			return nil, err
+		}
+		// Columns are read straight into the grid and the unused part of each column is skipped
+		allTileData := NewTileGrid(mapWidth, mapHeight, toaw4TileDataSize)
+		usedColumnSize := mapHeight * toaw4TileDataSize
+		for x := 0; x < mapWidth; x++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			columnStart := toaw4TileBlockOffset + int64(x*toaw4MaxMapSize*toaw4TileDataSize)
+			if err := streamReader.skipTo(columnStart); err != nil {
+				return nil, err
+			}
+			if _, err := io.ReadFull(streamReader, allTileData.data[x*usedColumnSize:(x+1)*usedColumnSize]); err != nil {
+				return nil, fmt.Errorf("failed to read tile data: %w", err)
+			}
+			progress.report(PhaseTiles, x)
+		}
+		mapData.AllTileData = allTileData
+	}
+
+	// This block seems to be in the same location
+	if opts.wants(SectionLocations) {
+		if err := streamReader.skipTo(toaw4LocationBlockOffset); err != nil {
+			return nil, err
+		}
+		locationBlock := make([]byte, toaw4LocationBlockSize)
+		if _, err := io.ReadFull(streamReader, locationBlock); err != nil {
+			return nil, fmt.Errorf("failed to read location data: %w", err)
+		}
+		mapData.AllLocationData = GetLocationData(locationBlock)
+		progress.report(PhaseLocations, -1)
+	}
+	progress.report(PhaseDone, -1)
+	return mapData, nil
+}
+
+// offsetReader keeps track of the position in a stream that can't seek.
+type offsetReader struct {
+	reader io.Reader
+	offset int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// skipTo discards data until the stream reaches offset.
+func (r *offsetReader) skipTo(offset int64) error {
+	if offset < r.offset {
+		return fmt.Errorf("can't skip back from offset %d to %d", r.offset, offset)
+	}
+	if _, err := io.CopyN(io.Discard, r, offset-r.offset); err != nil {
+		return fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+	}
+	return nil
+}
+
+func printMapHeader(mapHeader *TOAWMapHeader, codePage CodePage) {
 	fmt.Printf("  Version: %d\n", mapHeader.Version)
-	fmt.Printf("  Title: %s\n", string(bytes.Trim(mapHeader.MapTitle[:], "\x00")))
-	
-	description := string(bytes.Trim(mapHeader.MapDescription[:], "\x00"))
+	fmt.Printf("  Title: %s\n", cString(mapHeader.MapTitle[:], codePage))
+
+	description := cString(mapHeader.MapDescription[:], codePage)
 	if description != "" {
 		fmt.Printf("  Description: %s\n", description)
 	}
-	
+
 	// Only show victory messages if they're not empty
-	msg1 := string(bytes.Trim(mapHeader.EndMessageTeam1Victory1[:], "\x00"))
-	msg2 := string(bytes.Trim(mapHeader.EndMessageTeam1Victory2[:], "\x00"))
-	draw1 := string(bytes.Trim(mapHeader.EndMessageDraw1[:], "\x00"))
-	msg3 := string(bytes.Trim(mapHeader.EndMessageTeam2Victory[:], "\x00"))
-	draw2 := string(bytes.Trim(mapHeader.EndMessageDraw2[:], "\x00"))
-	
+	msg1 := cString(mapHeader.EndMessageTeam1Victory1[:], codePage)
+	msg2 := cString(mapHeader.EndMessageTeam1Victory2[:], codePage)
+	draw1 := cString(mapHeader.EndMessageDraw1[:], codePage)
+	msg3 := cString(mapHeader.EndMessageTeam2Victory[:], codePage)
+	draw2 := cString(mapHeader.EndMessageDraw2[:], codePage)
+
 	if msg1 != "" || msg2 != "" || draw1 != "" || msg3 != "" || draw2 != "" {
 		fmt.Println("Victory Messages:")
 		if msg1 != "" {
@@ -302,48 +399,8 @@ func ReadTOAW4Scenario(compressedFile *os.File) (*TOAWMapData, error) {
 			fmt.Printf("  Draw Message 2: %s\n", draw2)
 		}
 	}
-	
-	fmt.Printf("Team goes first: %d\n", mapHeader.TeamGoesFirst)
-
-	unknownData1 := make([]byte, 448)
-	if err := binary.Read(streamReader, binary.LittleEndian, &unknownData1); err != nil {
-		return nil, err
-	}
-	fmt.Println("unknownData1:", unknownData1)
-
-	// This is similar to TOAW3
-	decompressedBlock0 := make([]byte, 696)
-	if err := binary.Read(streamReader, binary.LittleEndian, &decompressedBlock0); err != nil {
-		return nil, err
-	}
-
-	// This block contains the map data
-	decompressedBlock1 := make([]byte, 48*700*700)
-	if err := binary.Read(streamReader, binary.LittleEndian, &decompressedBlock1); err != nil {
-		return nil, err
-	}
-
-	version := int(mapHeader.Version)
-	mapWidth := 1 + int(binary.LittleEndian.Uint32(unknownData1[132:136]))
-	mapHeight := 1 + int(binary.LittleEndian.Uint32(unknownData1[136:140]))
-
-	fmt.Printf("Map Dimensions: %dx%d\n", mapWidth, mapHeight)
-
-	// This block seems to be in the same location
-	// 144000 bytes long
-	// 36 bytes per location * 4000 locations maximum
-	locationBlock := decompressedFileContents[64859168:65003168]
 
-	mapData := &TOAWMapData{
-		Version:         version,
-		AllTileData:     GetTileData(decompressedBlock1, mapHeight, mapWidth),
-		AllLocationData: GetLocationData(locationBlock),
-		AllUnitData:     []*UnitData{},
-		AllTeamNameData: []*TeamNameData{},
-		MapWidth:        mapWidth,
-		MapHeight:       mapHeight,
-	}
-	return mapData, nil
+	fmt.Printf("Team goes first: %d\n", mapHeader.TeamGoesFirst)
 }
 
 func GetLocationData(locationBlock []byte) []LocationData {
@@ -357,12 +414,15 @@ func GetLocationData(locationBlock []byte) []LocationData {
 	return allLocationData
 }
 
-func GetTileData(mapBlock []byte, mapHeight int, mapWidth int) [][]*TileData {
-	allTileData := make([][]*TileData, mapHeight)
-	for i := 0; i < len(allTileData); i++ {
-		allTileData[i] = make([]*TileData, mapWidth)
+func GetTileData(mapBlock []byte, mapHeight int, mapWidth int) *TileGrid {
+	allTileData, err := getTileData(context.Background(), mapBlock, mapHeight, mapWidth, nil)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return allTileData
+}
 
+func getTileData(ctx context.Context, mapBlock []byte, mapHeight int, mapWidth int, progress *progressReporter) (*TileGrid, error) {
 	// The file format keeps the map block a constant size, but the unused data is set to zero bytes
 	var tileDataSize, columnDataSize int
 	if len(mapBlock) == 48*700*700 {
@@ -379,26 +439,24 @@ func GetTileData(mapBlock []byte, mapHeight int, mapWidth int) [][]*TileData {
 		tileDataSize = 47
 		columnDataSize = tileDataSize * 100
 	} else {
-		log.Fatal(fmt.Sprintf("Failed to read tile data block of length %v", len(mapBlock)))
+		return nil, fmt.Errorf("failed to read tile data block of length %v", len(mapBlock))
+	}
+	if mapHeight*tileDataSize > columnDataSize || mapWidth*columnDataSize > len(mapBlock) {
+		return nil, fmt.Errorf("map dimensions %dx%d don't fit in tile data block of length %v", mapWidth, mapHeight, len(mapBlock))
 	}
-	for x := 0; x < mapWidth; x++ {
-		columnStart := x * columnDataSize
-		columnEnd := (x + 1) * columnDataSize
-		columnData := mapBlock[columnStart:columnEnd]
-		streamReader := io.NewSectionReader(bytes.NewReader(columnData), int64(0), int64(len(columnData)))
-
-		for y := 0; y < mapHeight; y++ {
-			tileData := make([]byte, tileDataSize)
-			if err := binary.Read(streamReader, binary.LittleEndian, &tileData); err != nil {
-				log.Fatal("Failed to read tile data:", err)
-			}
 
-			allTileData[y][x] = &TileData{
-				Data: tileData[:],
-			}
+	// Only the used part of each column is copied, so the grid doesn't keep the whole block alive
+	allTileData := NewTileGrid(mapWidth, mapHeight, tileDataSize)
+	usedColumnSize := mapHeight * tileDataSize
+	for x := 0; x < mapWidth; x++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
+		columnStart := x * columnDataSize
+		copy(allTileData.data[x*usedColumnSize:(x+1)*usedColumnSize], mapBlock[columnStart:columnStart+usedColumnSize])
+		progress.report(PhaseTiles, x)
 	}
-	return allTileData
+	return allTileData, nil
 }
 
 func GetTeamNameData(decompressedBlocks [][]byte) []*TeamNameData {
@@ -0,0 +1,115 @@
+package fileio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/samuelyuan/TOAWMap/blast"
+)
+
+// readCompressedBlocks reads the size prefix and contents of each block
+// without decompressing anything, so the block boundaries are known up front.
+func readCompressedBlocks(streamReader io.Reader, totalBlocks int, progress *progressReporter) ([][]byte, error) {
+	compressedBlocks := make([][]byte, totalBlocks)
+	for i := 0; i < totalBlocks; i++ {
+		blockSize := uint32(0)
+		if err := binary.Read(streamReader, binary.LittleEndian, &blockSize); err != nil {
+			return nil, fmt.Errorf("failed to read size of block %d: %w", i, err)
+		}
+		fmt.Printf("Block %d: %d bytes\n", i, blockSize)
+
+		blockData := make([]byte, blockSize)
+		if _, err := io.ReadFull(streamReader, blockData); err != nil {
+			return nil, fmt.Errorf("failed to read block %d: %w", i, err)
+		}
+		compressedBlocks[i] = blockData
+		progress.report(PhaseReadBlock, i)
+	}
+	return compressedBlocks, nil
+}
+
+func decompressBlock(index int, blockData []byte, progress *progressReporter) ([]byte, error) {
+	// The blocks stored in this file are compressed using PKWare Compression Library
+	var decompressedData bytes.Buffer
+	consumed, err := blast.Decompress(&decompressedData, blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress block %d: %w", index, err)
+	}
+	// The size prefix should cover exactly one compressed stream
+	if consumed != len(blockData) {
+		progress.warning(fmt.Errorf("block %d declares %d bytes, but the compressed stream used %d bytes", index, len(blockData), consumed))
+	}
+	// dumpData(decompressedData.Bytes(), fmt.Sprintf("block%v.txt", index))
+	return decompressedData.Bytes(), nil
+}
+
+// locationBlockIndex returns the block with the location table, which moved in
+// version 0x79.
+func locationBlockIndex(version int) int {
+	if version >= 0x79 {
+		return 11
+	}
+	return 10
+}
+
+// neededBlocks returns the blocks that hold the sections opts asks for.
+func neededBlocks(version int, opts ReadOptions) []int {
+	needed := make([]int, 0, 4)
+	if opts.wants(SectionTiles) {
+		needed = append(needed, 1)
+	}
+	if opts.wants(SectionUnits) {
+		needed = append(needed, 2)
+	}
+	if opts.wants(SectionTeams) {
+		needed = append(needed, 4)
+	}
+	if opts.wants(SectionLocations) {
+		needed = append(needed, locationBlockIndex(version))
+	}
+	return needed
+}
+
+// decompressBlocks decompresses the blocks whose index is in needed using at
+// most workers goroutines. Blocks that are not needed are left nil.
+// Blocks that haven't started yet are skipped once ctx is cancelled.
+func decompressBlocks(ctx context.Context, compressedBlocks [][]byte, needed []int, workers int, progress *progressReporter) ([][]byte, error) {
+	decompressedBlocks := make([][]byte, len(compressedBlocks))
+	if workers > len(needed) {
+		workers = len(needed)
+	}
+
+	jobs := make(chan int)
+	errs := make([]error, len(compressedBlocks))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				decompressedBlocks[i], errs[i] = decompressBlock(i, compressedBlocks[i], progress)
+				progress.report(PhaseDecompress, i)
+			}
+		}()
+	}
+	for _, i := range needed {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decompressedBlocks, nil
+}
@@ -0,0 +1,121 @@
+package fileio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Literal-only compressed streams of "AIAIAIAIAIAIA" and "hello block"
+var (
+	blockAIA   = []byte{0x00, 0x04, 0x82, 0x24, 0x25, 0x8f, 0x80, 0x7f}
+	blockHello = []byte{0x00, 0x04, 0xd0, 0x94, 0x61, 0xc3, 0xe6, 0x0d, 0x08, 0x31, 0x6c, 0xde, 0x8c, 0x59, 0x0b, 0xf8, 0x07}
+)
+
+// compressedBlockStream returns 12 blocks with their size prefixes, as they are stored
+// in a scenario. Block 4 has unused bytes after its compressed data.
+func compressedBlockStream() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < 12; i++ {
+		block := blockAIA
+		if i%2 == 1 {
+			block = blockHello
+		}
+		if i == 4 {
+			block = append(append([]byte{}, block...), 0xde, 0xad)
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(len(block)))
+		buf.Write(block)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressBlocks(t *testing.T) {
+	compressedBlocks, err := readCompressedBlocks(bytes.NewReader(compressedBlockStream()), 12, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := make([]int, len(compressedBlocks))
+	for i := range all {
+		all[i] = i
+	}
+	sequential, err := decompressBlocks(context.Background(), compressedBlocks, all, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range sequential {
+		if expected := []string{"AIAIAIAIAIAIA", "hello block"}[i%2]; string(block) != expected {
+			t.Errorf("block %d is %q, expected %q", i, block, expected)
+		}
+	}
+
+	for _, test := range []struct {
+		opts    ReadOptions
+		version int
+		needed  []int
+	}{
+		{ReadOptions{Workers: 4}, 0x78, []int{1, 2, 4, 10}},
+		{ReadOptions{Workers: 4, Sections: SectionUnits | SectionLocations}, 0x78, []int{2, 10}},
+		{ReadOptions{Workers: 2, Sections: SectionLocations}, 0x79, []int{11}},
+		{ReadOptions{Workers: 4, Sections: SectionHeader}, 0x79, []int{}},
+	} {
+		needed := neededBlocks(test.version, test.opts)
+		if !reflect.DeepEqual(needed, test.needed) {
+			t.Errorf("sections %b need blocks %v, expected %v", test.opts.Sections, needed, test.needed)
+		}
+		var warnings []error
+		progress := &progressReporter{warn: func(err error) { warnings = append(warnings, err) }}
+		parallel, err := decompressBlocks(context.Background(), compressedBlocks, needed, test.opts.workers(), progress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, block := range parallel {
+			expected := sequential[i]
+			if !intsContain(needed, i) {
+				expected = nil
+			}
+			if !bytes.Equal(block, expected) || (block == nil) != (expected == nil) {
+				t.Errorf("sections %b: block %d is %q, expected %q", test.opts.Sections, i, block, expected)
+			}
+		}
+
+		// Only block 4 has unused bytes, and it's only reported if it was decompressed
+		if intsContain(needed, 4) {
+			if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "block 4 declares 10 bytes, but the compressed stream used 8 bytes") {
+				t.Errorf("sections %b: warnings are %v", test.opts.Sections, warnings)
+			}
+		} else if len(warnings) != 0 {
+			t.Errorf("sections %b: warnings are %v, expected none", test.opts.Sections, warnings)
+		}
+	}
+}
+
+func TestDecompressBlocksErrors(t *testing.T) {
+	compressedBlocks := [][]byte{blockAIA, blockAIA[:5]}
+	if _, err := decompressBlocks(context.Background(), compressedBlocks, []int{0, 1}, 2, nil); err == nil || !strings.Contains(err.Error(), "block 1") {
+		t.Errorf("error is %v, expected a truncated block 1", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := decompressBlocks(ctx, compressedBlocks, []int{0}, 1, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("error is %v, expected the context to be cancelled", err)
+	}
+
+	if _, err := readCompressedBlocks(bytes.NewReader(compressedBlockStream()), 13, nil); err == nil || !strings.Contains(err.Error(), "block 12") {
+		t.Errorf("error is %v, expected a missing block 12", err)
+	}
+}
+
+func intsContain(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package fileio
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GazetteerEntry is one named location with the terrain around it.
+type GazetteerEntry struct {
+	Index   int
+	Name    string
+	X       int
+	Y       int
+	Terrain Terrain
+	// Distance in hexes to the nearest tile with a road or railroad, or -1 if the map has none
+	RoadDistance     int
+	RailroadDistance int
+}
+
+var gazetteerColumns = []string{"index", "name", "x", "y", "terrain", "roadDistance", "railroadDistance"}
+
+// routeDistances finds the distance in hexes from every tile to the nearest tile that
+// has the route, with a breadth first search that starts from all of those tiles at once.
+// Tiles that can't reach the route have -1.
+func routeDistances(allTileData *TileGrid, route Route) []int {
+	width, height := allTileData.Width(), allTileData.Height()
+	distances := make([]int, width*height)
+	queue := []int{}
+	for i := range distances {
+		distances[i] = -1
+		if allTileData.At(i%width, i/width).RouteMask(route) != 0 {
+			distances[i] = 0
+			queue = append(queue, i)
+		}
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for direction := DirectionNorth; direction <= DirectionNorthwest; direction++ {
+			x, y := Neighbor(current%width, current/width, direction)
+			if x < 0 || y < 0 || x >= width || y >= height || distances[y*width+x] >= 0 {
+				continue
+			}
+			distances[y*width+x] = distances[current] + 1
+			queue = append(queue, y*width+x)
+		}
+	}
+	return distances
+}
+
+// NewGazetteer lists the locations that are in use, skipping the empty slots of the table.
+func NewGazetteer(mapData *TOAWMapData) []GazetteerEntry {
+	entries := []GazetteerEntry{}
+	var roadDistances, railroadDistances []int
+	if mapData.AllTileData != nil {
+		roadDistances = routeDistances(mapData.AllTileData, RouteRoad)
+		railroadDistances = routeDistances(mapData.AllTileData, RouteRailroad)
+	}
+
+	for i, location := range mapData.AllLocationData {
+		if location.IsEmpty() {
+			continue
+		}
+		entry := GazetteerEntry{
+			Index:            i,
+			Name:             location.NameString(mapData.CodePage),
+			X:                int(location.X),
+			Y:                int(location.Y),
+			Terrain:          TerrainEmpty,
+			RoadDistance:     -1,
+			RailroadDistance: -1,
+		}
+		if mapData.AllTileData != nil && mapData.AllTileData.Contains(entry.X, entry.Y) {
+			tile := entry.Y*mapData.AllTileData.Width() + entry.X
+			entry.Terrain = mapData.AllTileData.At(entry.X, entry.Y).Terrain()
+			entry.RoadDistance = roadDistances[tile]
+			entry.RailroadDistance = railroadDistances[tile]
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// WriteGazetteer writes the locations as csv with a header row.
+func WriteGazetteer(w io.Writer, entries []GazetteerEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write(gazetteerColumns)
+	for _, entry := range entries {
+		writer.Write([]string{
+			strconv.Itoa(entry.Index),
+			entry.Name,
+			strconv.Itoa(entry.X),
+			strconv.Itoa(entry.Y),
+			string(entry.Terrain),
+			strconv.Itoa(entry.RoadDistance),
+			strconv.Itoa(entry.RailroadDistance),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportGazetteer writes the named locations of the map to a csv file.
+func ExportGazetteer(mapData *TOAWMapData, outputFilename string) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	if err := WriteGazetteer(outputFile, NewGazetteer(mapData)); err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
+
+// gazetteerRow is a row of a gazetteer file that has been checked but not applied yet.
+type gazetteerRow struct {
+	line int
+	// index is the slot of the location, or -1 for a new location
+	index       int
+	name        string
+	x           int
+	y           int
+	hasPosition bool
+}
+
+// ReadGazetteer changes the locations of the map to match a csv file with at least the
+// index and name columns. Rows with an index rename that location and rows without one
+// add a new location in the first free slot that no other row uses. The x and y columns
+// move a location and are required for new ones. Other columns, like the ones written by
+// WriteGazetteer, are ignored. Every row is checked before the map is changed, so the
+// locations are left as they were if there is an error.
+func ReadGazetteer(r io.Reader, mapData *TOAWMapData) error {
+	rows, err := readGazetteerRows(r, mapData)
+	if err != nil {
+		return err
+	}
+
+	// Slots named by an index are reserved before the new locations get a free slot
+	usedBy := make(map[int]int)
+	for _, row := range rows {
+		if row.index < 0 {
+			continue
+		}
+		if line, ok := usedBy[row.index]; ok {
+			return fmt.Errorf("line %d: index %d is already used on line %d", row.line, row.index, line)
+		}
+		usedBy[row.index] = row.line
+	}
+	nextFree := 0
+	for i := range rows {
+		row := &rows[i]
+		if row.index < 0 {
+			for nextFree < len(mapData.AllLocationData) {
+				if _, used := usedBy[nextFree]; !used && mapData.AllLocationData[nextFree].IsEmpty() {
+					break
+				}
+				nextFree++
+			}
+			if nextFree == len(mapData.AllLocationData) {
+				return fmt.Errorf("line %d: the location table is full", row.line)
+			}
+			row.index = nextFree
+			usedBy[nextFree] = row.line
+		}
+		if !row.hasPosition && mapData.AllLocationData[row.index].IsEmpty() {
+			return fmt.Errorf("line %d: new location %s needs x and y", row.line, row.name)
+		}
+	}
+
+	for _, row := range rows {
+		location := &mapData.AllLocationData[row.index]
+		if row.hasPosition {
+			location.X, location.Y = int32(row.x), int32(row.y)
+		}
+		putCString(location.Name[:], row.name, mapData.CodePage)
+	}
+	return nil
+}
+
+// readGazetteerRows reads and checks the rows of a gazetteer file.
+func readGazetteerRows(r io.Reader, mapData *TOAWMapData) ([]gazetteerRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("the header has no name column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []gazetteerRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := gazetteerRow{line: line, index: -1, name: field(record, "name")}
+
+		if row.name == "" {
+			return nil, fmt.Errorf("line %d: the name is empty", line)
+		}
+		if len(encodeText(row.name, mapData.CodePage)) > len(LocationData{}.Name) {
+			return nil, fmt.Errorf("line %d: %s is longer than %d bytes", line, row.name, len(LocationData{}.Name))
+		}
+		if index := field(record, "index"); index != "" {
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 || i >= len(mapData.AllLocationData) {
+				return nil, fmt.Errorf("line %d: index %s is outside the location table", line, index)
+			}
+			row.index = i
+		}
+		if x, y := field(record, "x"), field(record, "y"); x != "" || y != "" {
+			var errX, errY error
+			row.x, errX = strconv.Atoi(x)
+			row.y, errY = strconv.Atoi(y)
+			if errX != nil || errY != nil || row.x < 0 || row.y < 0 || row.x >= mapData.MapWidth || row.y >= mapData.MapHeight {
+				return nil, fmt.Errorf("line %d: position %s,%s is outside the map", line, x, y)
+			}
+			row.hasPosition = true
+		}
+		rows = append(rows, row)
+	}
+}
+
+// ImportGazetteer applies the locations in a csv file to the map.
+func ImportGazetteer(filename string, mapData *TOAWMapData) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := ReadGazetteer(file, mapData); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package fileio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gazetteerMapData returns a 5x3 map with three location slots, Warsaw in slot 0 and
+// two free slots.
+func gazetteerMapData() *TOAWMapData {
+	mapData := syntheticMapData(5, 3, 48)
+	mapData.AllLocationData = make([]LocationData, 3)
+	for i := range mapData.AllLocationData {
+		mapData.AllLocationData[i] = LocationData{X: OffMapCoordinate, Y: OffMapCoordinate}
+	}
+	mapData.AllLocationData[0] = LocationData{X: 1, Y: 2}
+	putCString(mapData.AllLocationData[0].Name[:], "Warsaw", mapData.CodePage)
+	return mapData
+}
+
+func TestRouteDistances(t *testing.T) {
+	grid := NewTileGrid(5, 3, 48)
+	if distances := routeDistances(grid, RouteRoad); !reflect.DeepEqual(distances, []int{
+		-1, -1, -1, -1, -1,
+		-1, -1, -1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}) {
+		t.Errorf("distances without roads are %v", distances)
+	}
+
+	// The odd columns are half a hex higher, so (1, 1) is next to (0, 0)
+	grid.At(0, 0).SetRouteMask(RouteRoad, 1<<DirectionSoutheast)
+	expected := []int{
+		0, 1, 2, 3, 4,
+		1, 1, 2, 3, 4,
+		2, 2, 3, 3, 4,
+	}
+	if distances := routeDistances(grid, RouteRoad); !reflect.DeepEqual(distances, expected) {
+		t.Errorf("distances are %v, expected %v", distances, expected)
+	}
+}
+
+func TestGazetteerRoundTrip(t *testing.T) {
+	mapData := gazetteerMapData()
+	var buf bytes.Buffer
+	if err := WriteGazetteer(&buf, NewGazetteer(mapData)); err != nil {
+		t.Fatal(err)
+	}
+	imported := gazetteerMapData()
+	if err := ReadGazetteer(&buf, imported); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(imported.AllLocationData, mapData.AllLocationData) {
+		t.Error("locations changed after a round trip")
+	}
+}
+
+func TestReadGazetteer(t *testing.T) {
+	mapData := gazetteerMapData()
+	// The new location on the first line must not take slot 1, which the last line renames
+	err := ReadGazetteer(strings.NewReader("index,name,x,y\n,Kraków,4,0\n0,Warszawa,,\n1,Lodz,2,1\n"), mapData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []struct {
+		name string
+		x, y int32
+	}{{"Warszawa", 1, 2}, {"Lodz", 2, 1}, {"Kraków", 4, 0}} {
+		location := mapData.AllLocationData[i]
+		if location.NameString(mapData.CodePage) != expected.name {
+			t.Errorf("slot %d is %q, expected %q", i, location.NameString(mapData.CodePage), expected.name)
+		}
+		if location.X != expected.x || location.Y != expected.y {
+			t.Errorf("slot %d is at (%d, %d), expected (%d, %d)", i, location.X, location.Y, expected.x, expected.y)
+		}
+	}
+}
+
+func TestReadGazetteerErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		contents string
+		message  string
+	}{
+		{"full table", "name,x,y\nKrakow,4,0\nLodz,2,1\nPoznan,0,0\n", "line 4: the location table is full"},
+		{"long name", "index,name\n0," + strings.Repeat("x", len(LocationData{}.Name)+1) + "\n", "line 2: " + strings.Repeat("x", len(LocationData{}.Name)+1) + " is longer than"},
+		{"outside the map", "name,x,y\nKrakow,5,0\n", "line 2: position 5,0 is outside the map"},
+		{"negative position", "index,name,x,y\n0,Warsaw,1,-1\n", "line 2: position 1,-1 is outside the map"},
+		{"outside the table", "index,name\n3,Krakow\n", "line 2: index 3 is outside the location table"},
+		{"new location without position", "name\nKrakow\n", "line 2: new location Krakow needs x and y"},
+		{"same index twice", "index,name\n0,Warszawa\n0,Varsovie\n", "line 3: index 0 is already used on line 2"},
+		{"no name column", "index,x,y\n0,1,1\n", "the header has no name column"},
+	} {
+		mapData := gazetteerMapData()
+		err := ReadGazetteer(strings.NewReader(test.contents), mapData)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: error is %v, expected %q", test.name, err, test.message)
+		}
+		// Rows before the error must not be applied either
+		if !reflect.DeepEqual(mapData.AllLocationData, gazetteerMapData().AllLocationData) {
+			t.Errorf("%s: the locations were changed before the error", test.name)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package fileio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Sections of the terrain grid format, in the order they are written.
+// Every section has one line per row of the map and one cell per tile.
+const (
+	gridTerrainSection = "terrain"
+	gridForestSection  = "forest"
+	gridUrbanSection   = "urban"
+)
+
+var gridTerrainCodes = map[Terrain]string{
+	TerrainEmpty:        "-",
+	TerrainImpassable:   "X",
+	TerrainDeepWater:    "~",
+	TerrainShallowWater: "w",
+	TerrainMountains:    "M",
+	TerrainHills:        "h",
+	TerrainSand:         "s",
+	TerrainFloodedMarsh: "f",
+	TerrainMarsh:        "m",
+	TerrainGrass:        ".",
+}
+
+// Subtype codes, where "." means the tile has none of the features
+var gridForestCodes = map[Feature]string{
+	FeatureCForest: "c",
+	FeatureDForest: "d",
+	FeatureMForest: "m",
+	FeatureTForest: "t",
+}
+
+var gridUrbanCodes = map[Feature]string{
+	FeatureUrban1: "1",
+	FeatureUrban2: "2",
+	FeatureUrban3: "3",
+	FeatureUrban4: "4",
+}
+
+// gridSubtypeCode returns the code of the first feature of the family that is set
+func gridSubtypeCode(tileData TileData, codes map[Feature]string) string {
+	for _, feature := range AllFeatures {
+		if code, ok := codes[feature]; ok && tileData.HasFeature(feature) {
+			return code
+		}
+	}
+	return "."
+}
+
+func gridRouteCode(tileData TileData, route Route) string {
+	return fmt.Sprintf("%02x", tileData.RouteMask(route))
+}
+
+func gridSections() []string {
+	sections := []string{gridTerrainSection, gridForestSection, gridUrbanSection}
+	for _, route := range AllRoutes {
+		sections = append(sections, string(route))
+	}
+	return sections
+}
+
+// gridCode returns the code of a tile in a section
+func gridCode(tileData TileData, section string) string {
+	switch section {
+	case gridTerrainSection:
+		return gridTerrainCodes[tileData.Terrain()]
+	case gridForestSection:
+		return gridSubtypeCode(tileData, gridForestCodes)
+	case gridUrbanSection:
+		return gridSubtypeCode(tileData, gridUrbanCodes)
+	}
+	return gridRouteCode(tileData, Route(section))
+}
+
+// setGridCode changes the tile to match a code from a section.
+func setGridCode(tileData TileData, section string, code string) error {
+	switch section {
+	case gridTerrainSection:
+		for terrain, terrainCode := range gridTerrainCodes {
+			if terrainCode == code {
+				tileData.SetTerrain(terrain)
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown terrain %q", code)
+	case gridForestSection, gridUrbanSection:
+		codes := gridForestCodes
+		if section == gridUrbanSection {
+			codes = gridUrbanCodes
+		}
+		found := code == "."
+		for feature, featureCode := range codes {
+			tileData.SetFeature(feature, featureCode == code)
+			found = found || featureCode == code
+		}
+		if !found {
+			return fmt.Errorf("unknown %s subtype %q", section, code)
+		}
+		return nil
+	}
+	mask, err := strconv.ParseUint(code, 16, 8)
+	if err != nil || mask > 0x3f {
+		return fmt.Errorf("invalid %s directions %q", section, code)
+	}
+	tileData.SetRouteMask(Route(section), byte(mask))
+	return nil
+}
+
+// gridDelimiter returns the cell separator for a file, which is a comma for csv files
+// so they open in spreadsheets, and a space otherwise.
+func gridDelimiter(filename string) string {
+	if strings.ToLower(filepath.Ext(filename)) == ".csv" {
+		return ","
+	}
+	return " "
+}
+
+// WriteTerrainGrid writes the tiles as plain text grids, one section per terrain, subtype
+// or route. The format is described in GRID_FORMAT.md. A map without tiles can't be
+// written, since the grid needs a width and height of at least 1.
+func WriteTerrainGrid(w io.Writer, allTileData *TileGrid, delimiter string) error {
+	if allTileData.Width() == 0 || allTileData.Height() == 0 {
+		return fmt.Errorf("the map has no tiles")
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# TOAWMap terrain grid")
+	fmt.Fprintf(bw, "width%s%d\n", delimiter, allTileData.Width())
+	fmt.Fprintf(bw, "height%s%d\n", delimiter, allTileData.Height())
+	fmt.Fprintf(bw, "tilesize%s%d\n", delimiter, allTileData.TileSize())
+
+	cells := make([]string, allTileData.Width())
+	for _, section := range gridSections() {
+		fmt.Fprintf(bw, "[%s]\n", section)
+		for y := 0; y < allTileData.Height(); y++ {
+			for x := range cells {
+				cells[x] = gridCode(allTileData.At(x, y), section)
+			}
+			if _, err := fmt.Fprintln(bw, strings.Join(cells, delimiter)); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func splitGridLine(line string, delimiter string) []string {
+	if delimiter == " " {
+		return strings.Fields(line)
+	}
+	cells := strings.Split(line, delimiter)
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// ReadTerrainGrid reads grids written by WriteTerrainGrid. When a base map is given, its
+// tiles are changed in place and the rest of the map is kept. Tiles only change where a
+// code is different from the base, so flags the grid doesn't show are kept. Sections
+// that are left out of the file don't change anything.
+func ReadTerrainGrid(r io.Reader, base *TOAWMapData, delimiter string) (*TOAWMapData, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	header := map[string]int{"tilesize": 48}
+	var allTileData *TileGrid
+	section := ""
+	y := 0
+	seen := make(map[string]bool)
+	knownSections := make(map[string]bool)
+	for _, name := range gridSections() {
+		knownSections[name] = true
+	}
+
+	finishSection := func(lineNumber int) error {
+		if section != "" && y != allTileData.Height() {
+			return fmt.Errorf("line %d: section %s has %d rows, expected %d", lineNumber, section, y, allTileData.Height())
+		}
+		return nil
+	}
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(strings.TrimSpace(line), "]") {
+			if allTileData == nil {
+				width, height := header["width"], header["height"]
+				if width < 1 || height < 1 {
+					return nil, fmt.Errorf("line %d: width and height must be set before the first section", lineNumber)
+				}
+				if base != nil {
+					allTileData = base.AllTileData
+					if allTileData == nil {
+						return nil, fmt.Errorf("the base map has no tiles")
+					}
+					if allTileData.Width() != width || allTileData.Height() != height {
+						return nil, fmt.Errorf("the grid is %dx%d, but the base map is %dx%d", width, height, allTileData.Width(), allTileData.Height())
+					}
+				} else {
+					if tileSize := header["tilesize"]; tileSize != 47 && tileSize != 48 {
+						return nil, fmt.Errorf("tiles must be 47 or 48 bytes, got %d", tileSize)
+					}
+					allTileData = NewTileGrid(width, height, header["tilesize"])
+				}
+			}
+			if err := finishSection(lineNumber); err != nil {
+				return nil, err
+			}
+			section = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(line), "["), "]")
+			if !knownSections[section] {
+				return nil, fmt.Errorf("line %d: unknown section %s", lineNumber, section)
+			}
+			if seen[section] {
+				return nil, fmt.Errorf("line %d: section %s appears twice", lineNumber, section)
+			}
+			seen[section] = true
+			y = 0
+			continue
+		}
+
+		cells := splitGridLine(line, delimiter)
+		if section == "" {
+			if len(cells) != 2 {
+				return nil, fmt.Errorf("line %d: expected a name and a value", lineNumber)
+			}
+			value, err := strconv.Atoi(cells[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s must be a number", lineNumber, cells[0])
+			}
+			header[cells[0]] = value
+			continue
+		}
+
+		if y >= allTileData.Height() {
+			return nil, fmt.Errorf("line %d: section %s has more than %d rows", lineNumber, section, allTileData.Height())
+		}
+		if len(cells) != allTileData.Width() {
+			return nil, fmt.Errorf("line %d: expected %d cells, got %d", lineNumber, allTileData.Width(), len(cells))
+		}
+		for x, code := range cells {
+			tileData := allTileData.At(x, y)
+			if code == gridCode(tileData, section) {
+				continue
+			}
+			if err := setGridCode(tileData, section, code); err != nil {
+				return nil, fmt.Errorf("line %d, x %d: %w", lineNumber, x, err)
+			}
+		}
+		y++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if allTileData == nil {
+		return nil, fmt.Errorf("the file has no sections")
+	}
+	if err := finishSection(lineNumber); err != nil {
+		return nil, err
+	}
+
+	if base != nil {
+		return base, nil
+	}
+	return &TOAWMapData{
+		AllLocationData: []LocationData{},
+		AllTeamNameData: []*TeamNameData{},
+		AllTileData:     allTileData,
+		AllUnitData:     []*UnitData{},
+		MapWidth:        allTileData.Width(),
+		MapHeight:       allTileData.Height(),
+		CodePage:        defaultCodePage,
+	}, nil
+}
+
+// ExportTerrainGrid writes the tiles to a grid file. Files ending in .csv use commas
+// between the cells and other files use spaces.
+func ExportTerrainGrid(mapData *TOAWMapData, outputFilename string) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	if err := WriteTerrainGrid(outputFile, mapData.AllTileData, gridDelimiter(outputFilename)); err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
+
+// ImportTerrainGrid reads a grid file on top of the base map, which may be nil.
+func ImportTerrainGrid(filename string, base *TOAWMapData) (*TOAWMapData, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mapData, err := ReadTerrainGrid(file, base, gridDelimiter(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return mapData, nil
+}
@@ -0,0 +1,129 @@
+package fileio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// gridMapData returns a map with every terrain, subtype and route, including sand
+// subtypes, forests and urban areas on some of the tiles.
+func gridMapData() *TOAWMapData {
+	mapData := syntheticMapData(12, 8, 48)
+	mapData.AllTileData.Each(func(x int, y int, tileData TileData) {
+		switch (x + 3*y) % 5 {
+		case 0:
+			tileData.SetFeature(FeatureCForest, true)
+		case 1:
+			tileData.SetFeature(FeatureUrban3, true)
+		case 2:
+			if tileData.Terrain() == TerrainSand {
+				tileData.SetFeature(FeatureArid, false)
+				tileData.SetFeature(FeatureBadlands, true)
+			}
+		}
+		tileData.SetRouteMask(RouteRailroad, byte(x*y)&0x3f)
+	})
+	return mapData
+}
+
+func TestTerrainGridRoundTrip(t *testing.T) {
+	for _, delimiter := range []string{" ", ","} {
+		mapData := gridMapData()
+		var buf bytes.Buffer
+		if err := WriteTerrainGrid(&buf, mapData.AllTileData, delimiter); err != nil {
+			t.Fatal(err)
+		}
+		written := buf.String()
+
+		// Without a base map, every tile gets the codes of the grid
+		imported, err := ReadTerrainGrid(strings.NewReader(written), nil, delimiter)
+		if err != nil {
+			t.Fatalf("delimiter %q: %v", delimiter, err)
+		}
+		if imported.MapWidth != mapData.MapWidth || imported.MapHeight != mapData.MapHeight {
+			t.Fatalf("delimiter %q: map is %dx%d, expected %dx%d", delimiter, imported.MapWidth, imported.MapHeight, mapData.MapWidth, mapData.MapHeight)
+		}
+		mapData.AllTileData.Each(func(x int, y int, tileData TileData) {
+			for _, section := range gridSections() {
+				if code, expected := gridCode(imported.AllTileData.At(x, y), section), gridCode(tileData, section); code != expected {
+					t.Errorf("delimiter %q: tile (%d, %d) has %s %q, expected %q", delimiter, x, y, section, code, expected)
+				}
+			}
+		})
+
+		// With a base map, an unedited grid leaves every byte alone
+		base := gridMapData()
+		if _, err := ReadTerrainGrid(strings.NewReader(written), base, delimiter); err != nil {
+			t.Fatalf("delimiter %q: %v", delimiter, err)
+		}
+		if !bytes.Equal(base.AllTileData.Bytes(), mapData.AllTileData.Bytes()) {
+			t.Errorf("delimiter %q: tiles of the base map changed after a round trip", delimiter)
+		}
+	}
+}
+
+func TestReadTerrainGridEdits(t *testing.T) {
+	base := &TOAWMapData{AllTileData: NewTileGrid(3, 2, 48), MapWidth: 3, MapHeight: 2}
+	tile := base.AllTileData.At
+	tile(0, 0).SetTerrain(TerrainSand)
+	tile(0, 0).SetFeature(FeatureArid, false)
+	tile(0, 0).SetFeature(FeatureBadlands, true)
+	tile(0, 0).SetRouteMask(RouteRoad, 0x09)
+	tile(1, 0).SetTerrain(TerrainGrass)
+	tile(2, 0).SetTerrain(TerrainSand)
+	tile(2, 0).SetFeature(FeatureArid, false)
+	tile(2, 0).SetFeature(FeatureBadlands, true)
+	tile(0, 1).SetTerrain(TerrainEmpty)
+	tile(1, 1).SetFeature(FeatureCForest, true)
+	tile(2, 1).SetFeature(FeatureUrban2, true)
+	// A byte the grid doesn't show
+	tile(1, 1).Data[40] = 7
+
+	grid := "width 3\nheight 2\n" +
+		"[terrain]\n- s h\n. . .\n" +
+		"[forest]\n. . .\n. t .\n" +
+		"[urban]\n. . .\n. . .\n"
+	if _, err := ReadTerrainGrid(strings.NewReader(grid), base, " "); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty tile keeps its terrain and routes, so it can be made playable again
+	if !tile(0, 0).IsEmpty() || tile(0, 0).Data[featureIndex[FeatureBadlands]] == 0 || tile(0, 0).Data[routeIndex[RouteRoad]] != 0x09 {
+		t.Error("tile (0, 0) should be empty and keep its badlands and road")
+	}
+	if tile(1, 0).Terrain() != TerrainSand || !tile(1, 0).HasFeature(FeatureArid) {
+		t.Error("tile (1, 0) should be arid sand")
+	}
+	if tile(2, 0).Terrain() != TerrainHills || tile(2, 0).HasFeature(FeatureBadlands) {
+		t.Error("tile (2, 0) should be hills without badlands")
+	}
+	if tile(0, 1).Terrain() != TerrainGrass {
+		t.Errorf("tile (0, 1) is %s, expected grass", tile(0, 1).Terrain())
+	}
+	if !tile(1, 1).HasFeature(FeatureTForest) || tile(1, 1).HasFeature(FeatureCForest) || tile(1, 1).Data[40] != 7 {
+		t.Error("tile (1, 1) should change from c_forest to t_forest and keep its other bytes")
+	}
+	if tile(2, 1).IsUrban() {
+		t.Error("tile (2, 1) should no longer be urban")
+	}
+}
+
+func TestTerrainGridErrors(t *testing.T) {
+	if err := WriteTerrainGrid(&bytes.Buffer{}, nil, " "); err == nil {
+		t.Error("a map without tiles was written")
+	}
+
+	grid := "width 3\nheight 2\n[terrain]\n. . .\n. . .\n"
+	for _, test := range []struct {
+		base    *TOAWMapData
+		message string
+	}{
+		{&TOAWMapData{MapWidth: 3, MapHeight: 2}, "the base map has no tiles"},
+		{&TOAWMapData{AllTileData: NewTileGrid(4, 2, 48), MapWidth: 3, MapHeight: 2}, "the grid is 3x2, but the base map is 4x2"},
+	} {
+		if _, err := ReadTerrainGrid(strings.NewReader(grid), test.base, " "); err == nil || err.Error() != test.message {
+			t.Errorf("error is %v, expected %q", err, test.message)
+		}
+	}
+}
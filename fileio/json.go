@@ -1,41 +1,286 @@
 package fileio
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+// TOAWMapJson is the original json format, which is still accepted by the importer.
 type TOAWMapJson struct {
 	GameName   string
 	FileFormat string
 	MapData    *TOAWMapData
 }
 
-func ImportTOAWMapDataFromJson(inputFilename string) *TOAWMapData {
+// legacyMapJson is used to import the original format. The tiles are kept as
+// rows until they have been checked, so problems can be reported for each tile.
+type legacyMapJson struct {
+	GameName   string
+	FileFormat string
+	MapData    *legacyMapData
+}
+
+type legacyMapData struct {
+	Version         int
+	AllLocationData []LocationData
+	AllTeamNameData []*TeamNameData
+	AllTileData     [][]*TileData
+	AllUnitData     []*UnitData
+	MapWidth        int
+	MapHeight       int
+}
+
+// ImportTOAWMapDataFromJson reads a json file in either the current or the original format,
+// or a newline delimited json file if the extension is .ndjson.
+// The data is checked before it is returned, so a file that doesn't match its own
+// dimensions is reported as an error instead of failing later on.
+func ImportTOAWMapDataFromJson(inputFilename string) (*TOAWMapData, error) {
 	jsonFile, err := os.Open(inputFilename)
 	if err != nil {
-		log.Fatal("Failed to open json file", err)
+		return nil, fmt.Errorf("failed to open json file: %w", err)
 	}
 	defer jsonFile.Close()
 
-	jsonContents, err := io.ReadAll(jsonFile)
+	mapData, err := importTOAWMapJson(jsonFile, strings.ToLower(filepath.Ext(inputFilename)) == ".ndjson")
+	if err != nil {
+		return nil, fmt.Errorf("the json data in %s is incorrect:\n%w", inputFilename, err)
+	}
+	return mapData, nil
+}
+
+func importTOAWMapJson(jsonFile io.Reader, isNdjson bool) (*TOAWMapData, error) {
+	if isNdjson {
+		return ReadTOAWMapNdjson(jsonFile)
+	}
+
+	// Files written by the exporter start with the schema version and can be read
+	// one row at a time. Anything else is decoded as a whole.
+	reader := bufio.NewReaderSize(jsonFile, 4096)
+	start, _ := reader.Peek(4096)
+	if firstJsonKey(start) == "schemaVersion" {
+		return ReadTOAWMapJson(reader)
+	}
+	jsonContents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTOAWMapJson(jsonContents)
+}
+
+func firstJsonKey(start []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(start))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return ""
+	}
+	token, err := decoder.Token()
 	if err != nil {
-		log.Fatal(err)
+		return ""
 	}
+	key, _ := token.(string)
+	return key
+}
 
-	var mapJson *TOAWMapJson
-	json.Unmarshal(jsonContents, &mapJson)
+// DecodeTOAWMapJson decodes and checks a json document in either the current or the original format.
+func DecodeTOAWMapJson(jsonContents []byte) (*TOAWMapData, error) {
+	// The original format has no schema version
+	var versionJson struct {
+		SchemaVersion *int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(jsonContents, &versionJson); err != nil {
+		return nil, describeJsonError(jsonContents, err)
+	}
 
-	if mapJson == nil {
-		log.Fatal("The json data in " + inputFilename + " is missing or incorrect")
+	if versionJson.SchemaVersion == nil {
+		var mapJson legacyMapJson
+		if err := decodeStrict(jsonContents, &mapJson); err != nil {
+			return nil, err
+		}
+		if err := validateLegacyMapJson(&mapJson); err != nil {
+			return nil, err
+		}
+		return mapJson.MapData.toMapData()
 	}
 
-	return mapJson.MapData
+	if *versionJson.SchemaVersion != JsonSchemaVersion {
+		return nil, &ValidationError{Path: "schemaVersion", Message: fmt.Sprintf("unsupported version %d, expected %d", *versionJson.SchemaVersion, JsonSchemaVersion)}
+	}
+	var mapJson TOAWMapJsonV2
+	if err := decodeStrict(jsonContents, &mapJson); err != nil {
+		return nil, err
+	}
+	if err := mapJson.Validate(); err != nil {
+		return nil, err
+	}
+	return mapJson.ToMapData()
 }
 
+// decodeStrict rejects unknown fields and anything after the top level value.
+func decodeStrict(jsonContents []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(jsonContents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return describeJsonError(jsonContents, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return describeJsonError(jsonContents, fmt.Errorf("unexpected data after the end of the document at offset %d", decoder.InputOffset()))
+	}
+	return nil
+}
+
+// describeJsonError adds the position or the path of the value to errors from encoding/json.
+func describeJsonError(jsonContents []byte, err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		line, column := lineAndColumn(jsonContents, syntaxError.Offset)
+		return fmt.Errorf("invalid json at line %d, column %d: %w", line, column, err)
+	case errors.As(err, &typeError):
+		path := jsonPath(jsonContents, typeError.Offset)
+		if path == "" {
+			path = "(root)"
+		}
+		line, column := lineAndColumn(jsonContents, typeError.Offset)
+		return &ValidationError{
+			Path:    path,
+			Message: fmt.Sprintf("expected %v, found json %s at line %d, column %d", typeError.Type, typeError.Value, line, column),
+		}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("the json data is empty or truncated: %w", err)
+	}
+	return err
+}
+
+// jsonPath returns the path, like units[2].name, of the innermost value that starts
+// before the offset, or "" for the top level value.
+func jsonPath(data []byte, offset int64) string {
+	type level struct {
+		key   string
+		index int
+		// inObject is true for objects, and awaitingKey when the next token is a key
+		inObject    bool
+		awaitingKey bool
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var levels []*level
+	path := ""
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return path
+		}
+		var top *level
+		if len(levels) > 0 {
+			top = levels[len(levels)-1]
+		}
+		if top != nil && top.awaitingKey {
+			if key, ok := token.(string); ok {
+				top.key = key
+				top.awaitingKey = false
+				continue
+			}
+		}
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			levels = levels[:len(levels)-1]
+			if len(levels) > 0 && levels[len(levels)-1].inObject {
+				levels[len(levels)-1].awaitingKey = true
+			}
+			continue
+		}
+
+		// The token starts a value
+		if start >= offset {
+			return path
+		}
+		if top != nil && !top.inObject {
+			top.index++
+		}
+		var sb strings.Builder
+		for i, l := range levels {
+			if !l.inObject {
+				fmt.Fprintf(&sb, "[%d]", l.index)
+				continue
+			}
+			if i > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(l.key)
+		}
+		path = sb.String()
+
+		switch token {
+		case json.Delim('{'):
+			levels = append(levels, &level{inObject: true, awaitingKey: true})
+		case json.Delim('['):
+			levels = append(levels, &level{index: -1})
+		default:
+			if top != nil && top.inObject {
+				top.awaitingKey = true
+			}
+		}
+	}
+}
+
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := 1 + bytes.Count(before, []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func (mapData *legacyMapData) toMapData() (*TOAWMapData, error) {
+	var allTileData *TileGrid
+	if len(mapData.AllTileData) > 0 {
+		var err error
+		if allTileData, err = newTileGridFromRows(mapData.AllTileData); err != nil {
+			return nil, err
+		}
+	}
+	return &TOAWMapData{
+		Version:         mapData.Version,
+		AllLocationData: mapData.AllLocationData,
+		AllTeamNameData: mapData.AllTeamNameData,
+		AllTileData:     allTileData,
+		AllUnitData:     mapData.AllUnitData,
+		MapWidth:        mapData.MapWidth,
+		MapHeight:       mapData.MapHeight,
+		CodePage:        defaultCodePage,
+	}, nil
+}
+
+// ExportTOAWMapJson writes the map data using the current json format, one tile row at a time.
+// If the extension is .ndjson, the map data is written as newline delimited json instead.
 func ExportTOAWMapJson(mapData *TOAWMapData, outputFilename string) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	if strings.ToLower(filepath.Ext(outputFilename)) == ".ndjson" {
+		err = WriteTOAWMapNdjson(outputFile, mapData)
+	} else {
+		err = WriteTOAWMapJson(outputFile, mapData)
+	}
+	if err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
+
+// ExportTOAWMapJsonLegacy writes the map data using the original json format.
+func ExportTOAWMapJsonLegacy(mapData *TOAWMapData, outputFilename string) {
 	polytopiaJson := &TOAWMapJson{
 		GameName:   "TOAW",
 		FileFormat: "TOAW map scenario",
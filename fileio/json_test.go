@@ -0,0 +1,60 @@
+package fileio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJsonTypeErrorPath(t *testing.T) {
+	document := `{
+"schemaVersion": 2,
+"locations": [
+	{"index": 0, "name": "Warsaw", "x": 1, "y": 2},
+	{"index": 1, "name": 5, "x": 3, "y": 4}
+]
+}`
+	decodeErr := func(err error) *ValidationError {
+		var validationError *ValidationError
+		if !errors.As(err, &validationError) {
+			t.Fatalf("expected a validation error, found %v", err)
+		}
+		return validationError
+	}
+
+	_, err := DecodeTOAWMapJson([]byte(document))
+	validationError := decodeErr(err)
+	if validationError.Path != "locations[1].name" {
+		t.Errorf("path is %s, expected locations[1].name", validationError.Path)
+	}
+	if !strings.Contains(validationError.Message, "line 5") {
+		t.Errorf("message %q doesn't have the line of the value", validationError.Message)
+	}
+
+	_, err = ReadTOAWMapJson(strings.NewReader(document))
+	if validationError := decodeErr(err); validationError.Path != "locations[1].name" {
+		t.Errorf("streaming path is %s, expected locations[1].name", validationError.Path)
+	}
+}
+
+func TestJsonPath(t *testing.T) {
+	data := []byte(`{"a": [1, {"b": [[true], "x"]}], "c": {}, "d": 7}`)
+	for _, test := range []struct {
+		value string
+		path  string
+	}{
+		{`1`, "a[0]"},
+		{`true`, "a[1].b[0][0]"},
+		{`"x"`, "a[1].b[1]"},
+		{`{}`, "c"},
+		{`7`, "d"},
+	} {
+		offset := strings.Index(string(data), test.value) + len(test.value)
+		if path := jsonPath(data, int64(offset)); path != test.path {
+			t.Errorf("path of %s is %s, expected %s", test.value, path, test.path)
+		}
+	}
+	if path := jsonPath(data, 1); path != "" {
+		t.Errorf("path of the document is %s, expected it to be empty", path)
+	}
+}
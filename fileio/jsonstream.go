@@ -0,0 +1,422 @@
+package fileio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTOAWMapJson writes the map data to w in the version 2 format.
+// The tiles are encoded one row at a time with one row per line, so memory use
+// doesn't grow with the size of the map.
+func WriteTOAWMapJson(w io.Writer, mapData *TOAWMapData) error {
+	bw := bufio.NewWriter(w)
+	mapJson := newTOAWMapJsonV2(mapData)
+
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"schemaVersion", mapJson.SchemaVersion},
+		{"gameName", mapJson.GameName},
+		{"fileFormat", mapJson.FileFormat},
+		{"metadata", mapJson.Metadata},
+		{"map", mapJson.Map},
+	}
+	bw.WriteString("{\n")
+	for _, field := range fields {
+		if err := writeJsonField(bw, field.name, field.value); err != nil {
+			return err
+		}
+		bw.WriteString(",\n")
+	}
+
+	bw.WriteString(`"tiles":[`)
+	if allTileData := mapData.AllTileData; allTileData != nil {
+		for y := 0; y < allTileData.Height(); y++ {
+			if y > 0 {
+				bw.WriteByte(',')
+			}
+			bw.WriteByte('\n')
+			rowJson, err := json.Marshal(newTileRowJson(allTileData, y))
+			if err != nil {
+				return err
+			}
+			bw.Write(rowJson)
+		}
+	}
+	bw.WriteString("\n],\n")
+
+	if err := writeJsonField(bw, "locations", mapJson.Locations); err != nil {
+		return err
+	}
+	bw.WriteString(",\n")
+	if err := writeJsonField(bw, "teams", mapJson.Teams); err != nil {
+		return err
+	}
+	bw.WriteString(",\n")
+	if err := writeJsonField(bw, "units", mapJson.Units); err != nil {
+		return err
+	}
+	bw.WriteString("\n}\n")
+	return bw.Flush()
+}
+
+func writeJsonField(w *bufio.Writer, name string, value any) error {
+	valueJson, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	fmt.Fprintf(w, "%q:", name)
+	_, err = w.Write(valueJson)
+	return err
+}
+
+// Record types of the ndjson format. The type is stored in a record field, since
+// units already have a type field.
+const (
+	ndjsonHeader   = "header"
+	ndjsonRow      = "row"
+	ndjsonLocation = "location"
+	ndjsonTeam     = "team"
+	ndjsonUnit     = "unit"
+)
+
+type ndjsonHeaderRecord struct {
+	Record        string          `json:"record"`
+	SchemaVersion int             `json:"schemaVersion"`
+	GameName      string          `json:"gameName"`
+	FileFormat    string          `json:"fileFormat"`
+	Metadata      MapMetadataJson `json:"metadata"`
+	Map           MapInfoJson     `json:"map"`
+}
+
+type ndjsonRowRecord struct {
+	Record string `json:"record"`
+	TileRowJson
+}
+
+type ndjsonLocationRecord struct {
+	Record string `json:"record"`
+	LocationJson
+}
+
+type ndjsonTeamRecord struct {
+	Record string `json:"record"`
+	TeamJson
+}
+
+type ndjsonUnitRecord struct {
+	Record string `json:"record"`
+	UnitJson
+}
+
+// WriteTOAWMapNdjson writes the map data to w as newline delimited json.
+// Each line is one record: a header, then one record for every row, location, team and unit.
+// The records hold the same fields as the version 2 format, plus a record field with the record type.
+func WriteTOAWMapNdjson(w io.Writer, mapData *TOAWMapData) error {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	mapJson := newTOAWMapJsonV2(mapData)
+
+	if err := encoder.Encode(ndjsonHeaderRecord{
+		Record:        ndjsonHeader,
+		SchemaVersion: mapJson.SchemaVersion,
+		GameName:      mapJson.GameName,
+		FileFormat:    mapJson.FileFormat,
+		Metadata:      mapJson.Metadata,
+		Map:           mapJson.Map,
+	}); err != nil {
+		return err
+	}
+	if allTileData := mapData.AllTileData; allTileData != nil {
+		for y := 0; y < allTileData.Height(); y++ {
+			if err := encoder.Encode(ndjsonRowRecord{ndjsonRow, newTileRowJson(allTileData, y)}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, location := range mapJson.Locations {
+		if err := encoder.Encode(ndjsonLocationRecord{ndjsonLocation, location}); err != nil {
+			return err
+		}
+	}
+	for _, team := range mapJson.Teams {
+		if err := encoder.Encode(ndjsonTeamRecord{ndjsonTeam, team}); err != nil {
+			return err
+		}
+	}
+	for _, unit := range mapJson.Units {
+		if err := encoder.Encode(ndjsonUnitRecord{ndjsonUnit, unit}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// streamImporter builds the map data while the tile rows are read one at a time.
+// Everything except the tiles is collected in mapJson and checked at the end.
+type streamImporter struct {
+	mapJson     TOAWMapJsonV2
+	haveMap     bool
+	allTileData *TileGrid
+	numRows     int
+	seenRows    map[int]bool
+	// pendingRows holds the rows that are read before the map dimensions
+	pendingRows []pendingRow
+	v           validator
+}
+
+type pendingRow struct {
+	path string
+	row  *TileRowJson
+}
+
+func (s *streamImporter) setMap(info MapInfoJson) error {
+	s.mapJson.Map = info
+	s.haveMap = true
+	for _, pending := range s.pendingRows {
+		if err := s.addRow(pending.path, pending.row); err != nil {
+			return err
+		}
+	}
+	s.pendingRows = nil
+	return nil
+}
+
+func (s *streamImporter) addRow(rowPath string, row *TileRowJson) error {
+	if !s.haveMap {
+		s.pendingRows = append(s.pendingRows, pendingRow{rowPath, row})
+		return nil
+	}
+	info := s.mapJson.Map
+	if s.allTileData == nil {
+		if !s.v.checkDimensions("map.width", "map.height", info.Width, info.Height) {
+			return s.v.err()
+		}
+		if !isValidTileSize(info.TileSize) {
+			return &ValidationError{Path: "map.tileSize", Message: fmt.Sprintf("tile record is %d bytes, expected 47 or 48", info.TileSize)}
+		}
+		s.allTileData = NewTileGrid(info.Width, info.Height, info.TileSize)
+		s.seenRows = make(map[int]bool)
+	}
+	numErrors := len(s.v.errs)
+	s.v.checkTileRow(rowPath, row, info, s.seenRows)
+	s.numRows++
+	if len(s.v.errs) == numErrors {
+		s.allTileData.SetRow(row.Y, row.Raw)
+	}
+	return nil
+}
+
+func (s *streamImporter) finish() (*TOAWMapData, error) {
+	if !s.haveMap {
+		return nil, &ValidationError{Path: "map", Message: "missing"}
+	}
+	if s.numRows > 0 && s.numRows != s.mapJson.Map.Height {
+		s.v.addError("tiles", "has %d rows, expected %d to match map.height", s.numRows, s.mapJson.Map.Height)
+	}
+	if err := s.mapJson.Validate(); err != nil {
+		var errs ValidationErrors
+		if !errors.As(err, &errs) {
+			return nil, err
+		}
+		s.v.errs = append(s.v.errs, errs...)
+	}
+	if err := s.v.err(); err != nil {
+		return nil, err
+	}
+	mapData, err := s.mapJson.ToMapData()
+	if err != nil {
+		return nil, err
+	}
+	mapData.AllTileData = s.allTileData
+	return mapData, nil
+}
+
+// ReadTOAWMapJson reads a version 2 json document from r, decoding the tile rows
+// one at a time instead of loading the whole document first.
+// The map object should come before the tiles, which is how WriteTOAWMapJson writes it.
+// Otherwise the rows are kept until the map dimensions are read.
+func ReadTOAWMapJson(r io.Reader) (*TOAWMapData, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	decoder.DisallowUnknownFields()
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	s := &streamImporter{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+		switch key {
+		case "schemaVersion":
+			var schemaVersion int
+			if err := decodeField(decoder, key, &schemaVersion); err != nil {
+				return nil, err
+			}
+			if schemaVersion != JsonSchemaVersion {
+				return nil, &ValidationError{Path: key, Message: fmt.Sprintf("unsupported version %d, expected %d", schemaVersion, JsonSchemaVersion)}
+			}
+			s.mapJson.SchemaVersion = schemaVersion
+		case "gameName":
+			err = decodeField(decoder, key, &s.mapJson.GameName)
+		case "fileFormat":
+			err = decodeField(decoder, key, &s.mapJson.FileFormat)
+		case "metadata":
+			err = decodeField(decoder, key, &s.mapJson.Metadata)
+		case "map":
+			var info MapInfoJson
+			if err = decodeField(decoder, key, &info); err == nil {
+				err = s.setMap(info)
+			}
+		case "tiles":
+			if err := expectDelim(decoder, '['); err != nil {
+				return nil, err
+			}
+			for i := 0; decoder.More(); i++ {
+				rowPath := fmt.Sprintf("tiles[%d]", i)
+				var row TileRowJson
+				if err := decodeField(decoder, rowPath, &row); err != nil {
+					return nil, err
+				}
+				if err := s.addRow(rowPath, &row); err != nil {
+					return nil, err
+				}
+			}
+			err = expectDelim(decoder, ']')
+		case "locations":
+			err = decodeField(decoder, key, &s.mapJson.Locations)
+		case "teams":
+			err = decodeField(decoder, key, &s.mapJson.Teams)
+		case "units":
+			err = decodeField(decoder, key, &s.mapJson.Units)
+		default:
+			return nil, &ValidationError{Path: key, Message: "unknown field"}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+	if s.mapJson.SchemaVersion == 0 {
+		return nil, &ValidationError{Path: "schemaVersion", Message: "missing"}
+	}
+	return s.finish()
+}
+
+// ReadTOAWMapNdjson reads the records written by WriteTOAWMapNdjson from r.
+func ReadTOAWMapNdjson(r io.Reader) (*TOAWMapData, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	s := &streamImporter{}
+	for line := 1; ; line++ {
+		var record json.RawMessage
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %w", line, err)
+		}
+		recordPath := fmt.Sprintf("record %d", line)
+
+		var recordType struct {
+			Record string `json:"record"`
+		}
+		if err := json.Unmarshal(record, &recordType); err != nil {
+			return nil, fmt.Errorf("%s: %w", recordPath, err)
+		}
+		if line == 1 && recordType.Record != ndjsonHeader {
+			return nil, &ValidationError{Path: recordPath, Message: "the first record must be the header"}
+		}
+
+		var err error
+		switch recordType.Record {
+		case ndjsonHeader:
+			var header ndjsonHeaderRecord
+			if err = unmarshalRecord(record, recordPath, &header); err == nil {
+				if header.SchemaVersion != JsonSchemaVersion {
+					return nil, &ValidationError{Path: recordPath + ".schemaVersion", Message: fmt.Sprintf("unsupported version %d, expected %d", header.SchemaVersion, JsonSchemaVersion)}
+				}
+				s.mapJson.SchemaVersion = header.SchemaVersion
+				s.mapJson.GameName = header.GameName
+				s.mapJson.FileFormat = header.FileFormat
+				s.mapJson.Metadata = header.Metadata
+				err = s.setMap(header.Map)
+			}
+		case ndjsonRow:
+			var row ndjsonRowRecord
+			if err = unmarshalRecord(record, recordPath, &row); err == nil {
+				err = s.addRow(recordPath, &row.TileRowJson)
+			}
+		case ndjsonLocation:
+			var location ndjsonLocationRecord
+			if err = unmarshalRecord(record, recordPath, &location); err == nil {
+				s.mapJson.Locations = append(s.mapJson.Locations, location.LocationJson)
+			}
+		case ndjsonTeam:
+			var team ndjsonTeamRecord
+			if err = unmarshalRecord(record, recordPath, &team); err == nil {
+				s.mapJson.Teams = append(s.mapJson.Teams, team.TeamJson)
+			}
+		case ndjsonUnit:
+			var unit ndjsonUnitRecord
+			if err = unmarshalRecord(record, recordPath, &unit); err == nil {
+				s.mapJson.Units = append(s.mapJson.Units, unit.UnitJson)
+			}
+		default:
+			return nil, &ValidationError{Path: recordPath + ".record", Message: fmt.Sprintf("unknown record type %q", recordType.Record)}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.finish()
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v at offset %d, found %v", delim, decoder.InputOffset(), token)
+	}
+	return nil
+}
+
+// decodeField decodes the next value, adding the path to type errors.
+func decodeField(decoder *json.Decoder, path string, v any) error {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return unmarshalRecord(raw, path, v)
+}
+
+func unmarshalRecord(record json.RawMessage, path string, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(record))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		fieldPath := path
+		if valuePath := jsonPath(record, typeError.Offset); strings.HasPrefix(valuePath, "[") {
+			fieldPath += valuePath
+		} else if valuePath != "" {
+			fieldPath += "." + valuePath
+		}
+		return &ValidationError{Path: fieldPath, Message: fmt.Sprintf("expected %v, found json %s", typeError.Type, typeError.Value)}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
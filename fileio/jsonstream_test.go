@@ -0,0 +1,80 @@
+package fileio
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// mapDataWithUnits returns a small map with a location, the teams and a stack of two units.
+func mapDataWithUnits() *TOAWMapData {
+	mapData := syntheticMapData(12, 8, 48)
+	location := LocationData{X: 3, Y: 4}
+	copy(location.Name[:], "Warsaw")
+	mapData.AllLocationData = []LocationData{location}
+	copy(mapData.AllTeamNameData[0].ForceName[:], "Polish Army")
+	copy(mapData.AllTeamNameData[0].CountryName[:], "Poland")
+	for i := 0; i < 2; i++ {
+		unit := &UnitData{X: 3, Y: 4, UnitIndex: uint32(i), UnitColorAndType: 3, Proficiency: 70, OtherUnitIndexOnSameTile: 1000}
+		copy(unit.Name[:], "1st Infantry Div")
+		mapData.AllUnitData = append(mapData.AllUnitData, unit)
+	}
+	mapData.AllUnitData[0].OtherUnitIndexOnSameTile = 1
+	return mapData
+}
+
+func TestNdjsonRoundTrip(t *testing.T) {
+	mapData := mapDataWithUnits()
+	var buf bytes.Buffer
+	if err := WriteTOAWMapNdjson(&buf, mapData); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ReadTOAWMapNdjson(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported.AllTileData.Bytes(), mapData.AllTileData.Bytes()) {
+		t.Error("tiles changed after a round trip")
+	}
+	if len(imported.AllUnitData) < len(mapData.AllUnitData) {
+		t.Fatalf("found %d units, expected %d", len(imported.AllUnitData), len(mapData.AllUnitData))
+	}
+	for i, unit := range mapData.AllUnitData {
+		if imported.AllUnitData[i].UnitColorAndType != unit.UnitColorAndType {
+			t.Errorf("unit %d has color and type %d, expected %d", i, imported.AllUnitData[i].UnitColorAndType, unit.UnitColorAndType)
+		}
+	}
+}
+
+func TestReadTOAWMapJsonTilesBeforeMap(t *testing.T) {
+	mapData := mapDataWithUnits()
+	var buf bytes.Buffer
+	if err := WriteTOAWMapJson(&buf, mapData); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the tiles first and the map last
+	var reordered strings.Builder
+	reordered.WriteString("{")
+	for i, key := range []string{"tiles", "schemaVersion", "gameName", "fileFormat", "metadata", "locations", "teams", "units", "map"} {
+		if i > 0 {
+			reordered.WriteString(",")
+		}
+		reordered.WriteString(`"` + key + `":`)
+		reordered.Write(fields[key])
+	}
+	reordered.WriteString("}")
+
+	imported, err := ReadTOAWMapJson(strings.NewReader(reordered.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported.AllTileData.Bytes(), mapData.AllTileData.Bytes()) {
+		t.Error("tiles written before the map changed after a round trip")
+	}
+}
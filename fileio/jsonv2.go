@@ -0,0 +1,331 @@
+package fileio
+
+import "fmt"
+
+// JsonSchemaVersion is the current version of the exported json format.
+// Version 1 is the original format, which marshals TOAWMapData directly and has no schemaVersion field.
+const JsonSchemaVersion = 2
+
+// TOAWMapJsonV2 is the top level object of the version 2 json format.
+// The format is documented in JSON_FORMAT.md.
+type TOAWMapJsonV2 struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	GameName      string          `json:"gameName"`
+	FileFormat    string          `json:"fileFormat"`
+	Metadata      MapMetadataJson `json:"metadata"`
+	Map           MapInfoJson     `json:"map"`
+	Tiles         []TileRowJson   `json:"tiles"`
+	Locations     []LocationJson  `json:"locations"`
+	Teams         []TeamJson      `json:"teams"`
+	Units         []UnitJson      `json:"units"`
+}
+
+type MapMetadataJson struct {
+	Version       int              `json:"version"`
+	Title         string           `json:"title,omitempty"`
+	Description   string           `json:"description,omitempty"`
+	TeamGoesFirst uint32           `json:"teamGoesFirst,omitempty"`
+	EndMessages   *EndMessagesJson `json:"endMessages,omitempty"`
+}
+
+type EndMessagesJson struct {
+	Team1Victory1 string `json:"team1Victory1,omitempty"`
+	Team1Victory2 string `json:"team1Victory2,omitempty"`
+	Draw1         string `json:"draw1,omitempty"`
+	Team2Victory  string `json:"team2Victory,omitempty"`
+	Draw2         string `json:"draw2,omitempty"`
+}
+
+type MapInfoJson struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// TileSize is the length of each raw tile record, 47 or 48 bytes.
+	TileSize int `json:"tileSize"`
+	// The number of slots in the location and unit tables. Only the slots
+	// in use are exported, but the importer restores tables of this size.
+	LocationSlots int `json:"locationSlots"`
+	UnitSlots     int `json:"unitSlots"`
+}
+
+// TileRowJson holds one row of the map.
+type TileRowJson struct {
+	Y int `json:"y"`
+	// Raw is the tile records of the row in order of increasing x, base64 encoded.
+	// The importer reads the tiles from here, so the decoded tiles are informational.
+	Raw   []byte     `json:"raw"`
+	Tiles []TileJson `json:"tiles"`
+}
+
+type TileJson struct {
+	Terrain  Terrain        `json:"terrain"`
+	Features []Feature      `json:"features,omitempty"`
+	Routes   map[Route]byte `json:"routes,omitempty"`
+}
+
+type LocationJson struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+type TeamJson struct {
+	CountryName   string `json:"countryName"`
+	ForceName     string `json:"forceName"`
+	Proficiency   uint32 `json:"proficiency"`
+	SupplyLevel   uint32 `json:"supplyLevel"`
+	CountryFlagId uint32 `json:"countryFlagId"`
+}
+
+type UnitJson struct {
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	ColorGroup  int    `json:"colorGroup"`
+	Type        int    `json:"type"`
+	Proficiency uint32 `json:"proficiency"`
+	Readiness   uint32 `json:"readiness"`
+	SupplyLevel uint32 `json:"supplyLevel"`
+	// X and Y are omitted for units that are off the map
+	X *int `json:"x,omitempty"`
+	Y *int `json:"y,omitempty"`
+	// NextUnitOnSameTile is the index of the next unit in the same stack, if any
+	NextUnitOnSameTile *int `json:"nextUnitOnSameTile,omitempty"`
+}
+
+func newTileJson(tileData TileData) TileJson {
+	tileJson := TileJson{
+		Terrain:  tileData.Terrain(),
+		Features: tileData.Features(),
+	}
+	for _, route := range AllRoutes {
+		if mask := tileData.RouteMask(route); mask != 0 {
+			if tileJson.Routes == nil {
+				tileJson.Routes = make(map[Route]byte)
+			}
+			tileJson.Routes[route] = mask
+		}
+	}
+	return tileJson
+}
+
+func newTileRowJson(allTileData *TileGrid, y int) TileRowJson {
+	row := TileRowJson{
+		Y:     y,
+		Raw:   allTileData.Row(y, nil),
+		Tiles: make([]TileJson, allTileData.Width()),
+	}
+	for x := range row.Tiles {
+		row.Tiles[x] = newTileJson(allTileData.At(x, y))
+	}
+	return row
+}
+
+func newMapMetadataJson(mapData *TOAWMapData) MapMetadataJson {
+	metadata := MapMetadataJson{Version: mapData.Version}
+	if mapHeader := mapData.Header; mapHeader != nil {
+		metadata.Title = cString(mapHeader.MapTitle[:], mapData.CodePage)
+		metadata.Description = cString(mapHeader.MapDescription[:], mapData.CodePage)
+		metadata.TeamGoesFirst = mapHeader.TeamGoesFirst
+		endMessages := EndMessagesJson{
+			Team1Victory1: cString(mapHeader.EndMessageTeam1Victory1[:], mapData.CodePage),
+			Team1Victory2: cString(mapHeader.EndMessageTeam1Victory2[:], mapData.CodePage),
+			Draw1:         cString(mapHeader.EndMessageDraw1[:], mapData.CodePage),
+			Team2Victory:  cString(mapHeader.EndMessageTeam2Victory[:], mapData.CodePage),
+			Draw2:         cString(mapHeader.EndMessageDraw2[:], mapData.CodePage),
+		}
+		if endMessages != (EndMessagesJson{}) {
+			metadata.EndMessages = &endMessages
+		}
+	}
+	return metadata
+}
+
+func newUnitJson(index int, unitData *UnitData, unitSlots int, codePage CodePage) UnitJson {
+	unitJson := UnitJson{
+		Index:       index,
+		Name:        unitData.NameString(codePage),
+		ColorGroup:  unitData.ColorGroup(),
+		Type:        unitData.UnitType(),
+		Proficiency: unitData.Proficiency,
+		Readiness:   unitData.Readiness,
+		SupplyLevel: unitData.SupplyLevel,
+	}
+	if unitData.IsOnMap() {
+		x, y := int(unitData.X), int(unitData.Y)
+		unitJson.X, unitJson.Y = &x, &y
+	}
+	if next := int(unitData.OtherUnitIndexOnSameTile); next < unitSlots {
+		unitJson.NextUnitOnSameTile = &next
+	}
+	return unitJson
+}
+
+// newTOAWMapJsonV2 converts everything except the tile rows, which are added by the caller.
+func newTOAWMapJsonV2(mapData *TOAWMapData) *TOAWMapJsonV2 {
+	mapJson := &TOAWMapJsonV2{
+		SchemaVersion: JsonSchemaVersion,
+		GameName:      "TOAW",
+		FileFormat:    "TOAW map scenario",
+		Metadata:      newMapMetadataJson(mapData),
+		Map: MapInfoJson{
+			Width:         mapData.MapWidth,
+			Height:        mapData.MapHeight,
+			LocationSlots: len(mapData.AllLocationData),
+			UnitSlots:     len(mapData.AllUnitData),
+		},
+		Tiles:     []TileRowJson{},
+		Locations: []LocationJson{},
+		Teams:     []TeamJson{},
+		Units:     []UnitJson{},
+	}
+	if mapData.AllTileData != nil {
+		mapJson.Map.TileSize = mapData.AllTileData.TileSize()
+	}
+	for i, location := range mapData.AllLocationData {
+		if location.IsEmpty() {
+			continue
+		}
+		mapJson.Locations = append(mapJson.Locations, LocationJson{
+			Index: i,
+			Name:  location.NameString(mapData.CodePage),
+			X:     int(location.X),
+			Y:     int(location.Y),
+		})
+	}
+	for _, teamNameData := range mapData.AllTeamNameData {
+		mapJson.Teams = append(mapJson.Teams, TeamJson{
+			CountryName:   teamNameData.CountryNameString(mapData.CodePage),
+			ForceName:     teamNameData.ForceNameString(mapData.CodePage),
+			Proficiency:   teamNameData.Proficiency,
+			SupplyLevel:   teamNameData.SupplyLevel,
+			CountryFlagId: teamNameData.CountryFlagId,
+		})
+	}
+	for i, unitData := range mapData.AllUnitData {
+		// Unused unit slots have no name
+		if unitData.NameString(mapData.CodePage) == "" {
+			continue
+		}
+		mapJson.Units = append(mapJson.Units, newUnitJson(i, unitData, len(mapData.AllUnitData), mapData.CodePage))
+	}
+	return mapJson
+}
+
+// NewTOAWMapJsonV2 converts the map data to the version 2 json format.
+func NewTOAWMapJsonV2(mapData *TOAWMapData) *TOAWMapJsonV2 {
+	mapJson := newTOAWMapJsonV2(mapData)
+	if mapData.AllTileData != nil {
+		for y := 0; y < mapData.AllTileData.Height(); y++ {
+			mapJson.Tiles = append(mapJson.Tiles, newTileRowJson(mapData.AllTileData, y))
+		}
+	}
+	return mapJson
+}
+
+// NewTOAWMapJsonV2WithoutTiles converts everything except the tiles, for formats
+// that store the tiles their own way.
+func NewTOAWMapJsonV2WithoutTiles(mapData *TOAWMapData) *TOAWMapJsonV2 {
+	return newTOAWMapJsonV2(mapData)
+}
+
+func newMapHeader(metadata MapMetadataJson, codePage CodePage) *TOAWMapHeader {
+	mapHeader := &TOAWMapHeader{
+		Version:       uint32(metadata.Version),
+		TeamGoesFirst: metadata.TeamGoesFirst,
+	}
+	putCString(mapHeader.MapTitle[:], metadata.Title, codePage)
+	putCString(mapHeader.MapDescription[:], metadata.Description, codePage)
+	if endMessages := metadata.EndMessages; endMessages != nil {
+		putCString(mapHeader.EndMessageTeam1Victory1[:], endMessages.Team1Victory1, codePage)
+		putCString(mapHeader.EndMessageTeam1Victory2[:], endMessages.Team1Victory2, codePage)
+		putCString(mapHeader.EndMessageDraw1[:], endMessages.Draw1, codePage)
+		putCString(mapHeader.EndMessageTeam2Victory[:], endMessages.Team2Victory, codePage)
+		putCString(mapHeader.EndMessageDraw2[:], endMessages.Draw2, codePage)
+	}
+	return mapHeader
+}
+
+// emptyUnitData returns the unit stored in unused slots of a table with unitSlots entries.
+func emptyUnitData(index int, unitSlots int) *UnitData {
+	return &UnitData{
+		X:                        OffMapCoordinate,
+		Y:                        OffMapCoordinate,
+		OtherUnitIndexOnSameTile: uint32(unitSlots),
+		UnitIndex:                uint32(index),
+	}
+}
+
+// ToMapData converts the version 2 json format back to map data.
+// Header fields and unit data that the format doesn't keep are left zero.
+// The text is stored in the default code page.
+func (mapJson *TOAWMapJsonV2) ToMapData() (*TOAWMapData, error) {
+	info := mapJson.Map
+	codePage := defaultCodePage
+	mapData := &TOAWMapData{
+		Header:          newMapHeader(mapJson.Metadata, codePage),
+		Version:         mapJson.Metadata.Version,
+		AllLocationData: make([]LocationData, info.LocationSlots),
+		AllTeamNameData: make([]*TeamNameData, len(mapJson.Teams)),
+		AllUnitData:     make([]*UnitData, info.UnitSlots),
+		MapWidth:        info.Width,
+		MapHeight:       info.Height,
+		CodePage:        codePage,
+	}
+
+	if len(mapJson.Tiles) > 0 {
+		mapData.AllTileData = NewTileGrid(info.Width, info.Height, info.TileSize)
+		for _, row := range mapJson.Tiles {
+			if row.Y < 0 || row.Y >= info.Height {
+				return nil, fmt.Errorf("tile row %d is outside the map", row.Y)
+			}
+			if err := mapData.AllTileData.SetRow(row.Y, row.Raw); err != nil {
+				return nil, fmt.Errorf("tile row %d: %w", row.Y, err)
+			}
+		}
+	}
+
+	for i := range mapData.AllLocationData {
+		mapData.AllLocationData[i] = LocationData{X: OffMapCoordinate, Y: OffMapCoordinate}
+	}
+	for _, locationJson := range mapJson.Locations {
+		if locationJson.Index < 0 || locationJson.Index >= info.LocationSlots {
+			return nil, fmt.Errorf("location %d is outside the location table", locationJson.Index)
+		}
+		location := &mapData.AllLocationData[locationJson.Index]
+		location.X, location.Y = int32(locationJson.X), int32(locationJson.Y)
+		putCString(location.Name[:], locationJson.Name, codePage)
+	}
+
+	for i, teamJson := range mapJson.Teams {
+		teamNameData := &TeamNameData{
+			Proficiency:   teamJson.Proficiency,
+			SupplyLevel:   teamJson.SupplyLevel,
+			CountryFlagId: teamJson.CountryFlagId,
+		}
+		putCString(teamNameData.CountryName[:], teamJson.CountryName, codePage)
+		putCString(teamNameData.ForceName[:], teamJson.ForceName, codePage)
+		mapData.AllTeamNameData[i] = teamNameData
+	}
+
+	for i := range mapData.AllUnitData {
+		mapData.AllUnitData[i] = emptyUnitData(i, info.UnitSlots)
+	}
+	for _, unitJson := range mapJson.Units {
+		if unitJson.Index < 0 || unitJson.Index >= info.UnitSlots {
+			return nil, fmt.Errorf("unit %d is outside the unit table", unitJson.Index)
+		}
+		unitData := mapData.AllUnitData[unitJson.Index]
+		putCString(unitData.Name[:], unitJson.Name, codePage)
+		unitData.SetColorGroupAndType(unitJson.ColorGroup, unitJson.Type)
+		unitData.Proficiency = unitJson.Proficiency
+		unitData.Readiness = unitJson.Readiness
+		unitData.SupplyLevel = unitJson.SupplyLevel
+		if unitJson.X != nil && unitJson.Y != nil {
+			unitData.X, unitData.Y = int32(*unitJson.X), int32(*unitJson.Y)
+		}
+		if unitJson.NextUnitOnSameTile != nil {
+			unitData.OtherUnitIndexOnSameTile = uint32(*unitJson.NextUnitOnSameTile)
+		}
+	}
+	return mapData, nil
+}
@@ -0,0 +1,128 @@
+package fileio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderOfBattleUnit is one unit in the order of battle.
+type OrderOfBattleUnit struct {
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	ColorGroup  int    `json:"colorGroup"`
+	Type        int    `json:"type"`
+	Proficiency uint32 `json:"proficiency"`
+	Readiness   uint32 `json:"readiness"`
+	SupplyLevel uint32 `json:"supplyLevel"`
+	// X and Y are omitted for units that are off the map
+	X      *int `json:"x,omitempty"`
+	Y      *int `json:"y,omitempty"`
+	OffMap bool `json:"offMap"`
+	// Stack numbers the tiles with units, starting at 1, in the order of their first unit.
+	// Units off the map aren't in a stack and have 0.
+	Stack     int `json:"stack"`
+	StackSize int `json:"stackSize"`
+}
+
+// NewOrderOfBattle lists every unit slot that is in use.
+func NewOrderOfBattle(mapData *TOAWMapData) []OrderOfBattleUnit {
+	units := []OrderOfBattleUnit{}
+	stacks := make(map[[2]int][]int)
+	for i, unitData := range mapData.AllUnitData {
+		// Unused unit slots have no name
+		if unitData.NameString(mapData.CodePage) == "" {
+			continue
+		}
+		unit := OrderOfBattleUnit{
+			Index:       i,
+			Name:        strings.TrimSpace(unitData.NameString(mapData.CodePage)),
+			ColorGroup:  unitData.ColorGroup(),
+			Type:        unitData.UnitType(),
+			Proficiency: unitData.Proficiency,
+			Readiness:   unitData.Readiness,
+			SupplyLevel: unitData.SupplyLevel,
+			OffMap:      !unitData.IsOnMap(),
+		}
+		if unitData.IsOnMap() {
+			x, y := int(unitData.X), int(unitData.Y)
+			unit.X, unit.Y = &x, &y
+			stacks[[2]int{x, y}] = append(stacks[[2]int{x, y}], len(units))
+		}
+		units = append(units, unit)
+	}
+
+	stackList := make([][]int, 0, len(stacks))
+	for _, members := range stacks {
+		stackList = append(stackList, members)
+	}
+	// The members are in unit order, so the first one decides the order of the stacks
+	sort.Slice(stackList, func(i, j int) bool { return stackList[i][0] < stackList[j][0] })
+	for i, members := range stackList {
+		for _, member := range members {
+			units[member].Stack = i + 1
+			units[member].StackSize = len(members)
+		}
+	}
+	return units
+}
+
+// WriteOrderOfBattleCsv writes one line per unit. Units off the map have "off-map" as their position.
+func WriteOrderOfBattleCsv(w io.Writer, units []OrderOfBattleUnit) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"index", "name", "colorGroup", "type", "proficiency", "readiness", "supplyLevel", "x", "y", "stack", "stackSize"})
+	for _, unit := range units {
+		x, y := "off-map", "off-map"
+		if !unit.OffMap {
+			x, y = strconv.Itoa(*unit.X), strconv.Itoa(*unit.Y)
+		}
+		writer.Write([]string{
+			strconv.Itoa(unit.Index),
+			unit.Name,
+			strconv.Itoa(unit.ColorGroup),
+			strconv.Itoa(unit.Type),
+			strconv.FormatUint(uint64(unit.Proficiency), 10),
+			strconv.FormatUint(uint64(unit.Readiness), 10),
+			strconv.FormatUint(uint64(unit.SupplyLevel), 10),
+			x,
+			y,
+			strconv.Itoa(unit.Stack),
+			strconv.Itoa(unit.StackSize),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteOrderOfBattleJson writes the units as a json array.
+func WriteOrderOfBattleJson(w io.Writer, units []OrderOfBattleUnit) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(units)
+}
+
+// ExportOrderOfBattle writes the order of battle as csv if the file name ends in .csv,
+// and as json otherwise.
+func ExportOrderOfBattle(mapData *TOAWMapData, outputFilename string) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	units := NewOrderOfBattle(mapData)
+	if strings.ToLower(filepath.Ext(outputFilename)) == ".csv" {
+		err = WriteOrderOfBattleCsv(outputFile, units)
+	} else {
+		err = WriteOrderOfBattleJson(outputFile, units)
+	}
+	if err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
@@ -0,0 +1,87 @@
+package fileio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// oobMapData returns a map with two stacks of two units, a single unit, a unit off the
+// map and an unused slot.
+func oobMapData() *TOAWMapData {
+	mapData := syntheticMapData(4, 3, 48)
+	for i, unit := range []struct {
+		name string
+		x, y int32
+	}{
+		{"1st Division", 2, 1},
+		{"", OffMapCoordinate, OffMapCoordinate},
+		{"2nd Division", 0, 0},
+		{"3rd Division", 2, 1},
+		{"Reserve", OffMapCoordinate, OffMapCoordinate},
+		{"4th Division", 0, 0},
+		{" Cavalry ", 1, 2},
+	} {
+		unitData := &UnitData{X: unit.x, Y: unit.y, UnitIndex: uint32(i), Proficiency: 60, Readiness: 80, SupplyLevel: 90}
+		unitData.SetColorGroupAndType(i%2, 3)
+		putCString(unitData.Name[:], unit.name, mapData.CodePage)
+		mapData.AllUnitData = append(mapData.AllUnitData, unitData)
+	}
+	return mapData
+}
+
+func TestNewOrderOfBattle(t *testing.T) {
+	units := NewOrderOfBattle(oobMapData())
+	expected := []struct {
+		index     int
+		name      string
+		stack     int
+		stackSize int
+	}{
+		{0, "1st Division", 1, 2},
+		{2, "2nd Division", 2, 2},
+		{3, "3rd Division", 1, 2},
+		{4, "Reserve", 0, 0},
+		{5, "4th Division", 2, 2},
+		{6, "Cavalry", 3, 1},
+	}
+	if len(units) != len(expected) {
+		t.Fatalf("found %d units, expected %d", len(units), len(expected))
+	}
+	for i, unit := range units {
+		if unit.Index != expected[i].index || unit.Name != expected[i].name {
+			t.Errorf("unit %d is %d %q, expected %d %q", i, unit.Index, unit.Name, expected[i].index, expected[i].name)
+		}
+		if unit.Stack != expected[i].stack || unit.StackSize != expected[i].stackSize {
+			t.Errorf("%s is in stack %d of %d units, expected stack %d of %d", unit.Name, unit.Stack, unit.StackSize, expected[i].stack, expected[i].stackSize)
+		}
+		if unit.OffMap != (unit.Name == "Reserve") || unit.OffMap != (unit.X == nil) {
+			t.Errorf("%s is off the map: %v, with position %v", unit.Name, unit.OffMap, unit.X)
+		}
+	}
+}
+
+func TestWriteOrderOfBattleCsv(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOrderOfBattleCsv(&buf, NewOrderOfBattle(oobMapData())); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"index,name,colorGroup,type,proficiency,readiness,supplyLevel,x,y,stack,stackSize",
+		"0,1st Division,0,3,60,80,90,2,1,1,2",
+		"2,2nd Division,0,3,60,80,90,0,0,2,2",
+		"3,3rd Division,1,3,60,80,90,2,1,1,2",
+		"4,Reserve,0,3,60,80,90,off-map,off-map,0,0",
+		"5,4th Division,1,3,60,80,90,0,0,2,2",
+		"6,Cavalry,0,3,60,80,90,1,2,3,1",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("found %d lines, expected %d:\n%s", len(lines), len(expected), buf.String())
+	}
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d is %q, expected %q", i+1, lines[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package fileio
+
+import "runtime"
+
+// Section selects a part of the scenario to decode.
+type Section uint
+
+const (
+	SectionTiles Section = 1 << iota
+	SectionUnits
+	SectionTeams
+	SectionLocations
+	SectionHeader
+
+	SectionAll = SectionTiles | SectionUnits | SectionTeams | SectionLocations | SectionHeader
+)
+
+// ReadOptions controls how a scenario file is read.
+type ReadOptions struct {
+	// Sections lists the parts of the scenario to decode. The parts that are
+	// left out are not decompressed and stay empty in the map data.
+	// Zero decodes everything.
+	Sections Section
+	// Workers is the maximum number of blocks decompressed at the same time.
+	// Zero uses one worker per CPU.
+	Workers int
+	// Progress is called as each part of the file is read, if it is set.
+	Progress func(Progress)
+	// Warning is called with problems that don't stop the file from being read, like
+	// a block with unused bytes after its compressed data, if it is set.
+	Warning func(error)
+	// CodePage is the code page of the names and messages in the scenario.
+	// Empty uses the default code page, see SetCodePage.
+	CodePage CodePage
+}
+
+func (opts ReadOptions) wants(section Section) bool {
+	return opts.Sections == 0 || opts.Sections&section != 0
+}
+
+func (opts ReadOptions) workers() int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+	return runtime.NumCPU()
+}
+
+func (opts ReadOptions) codePage() CodePage {
+	if opts.CodePage != "" {
+		return opts.CodePage
+	}
+	return defaultCodePage
+}
@@ -0,0 +1,90 @@
+package fileio
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Phase describes what the reader is doing when it reports progress.
+type Phase string
+
+const (
+	PhaseHeader     Phase = "header"
+	PhaseReadBlock  Phase = "read block"
+	PhaseDecompress Phase = "decompress block"
+	PhaseTiles      Phase = "tiles"
+	PhaseLocations  Phase = "locations"
+	PhaseDone       Phase = "done"
+)
+
+// Progress is passed to the progress callback while a scenario is loading.
+type Progress struct {
+	Phase Phase
+	// Block is the index of the compressed block for the block phases and -1 otherwise.
+	// While decoding tiles it is the index of the last column read.
+	Block int
+	// BytesRead is the number of bytes read from the input file so far.
+	BytesRead int64
+	// TotalBytes is the size of the input file, or 0 if it isn't known.
+	TotalBytes int64
+}
+
+// contextReader counts the bytes read from the input and stops reading
+// as soon as the context is cancelled.
+type contextReader struct {
+	ctx       context.Context
+	reader    io.Reader
+	bytesRead int64
+	mu        sync.Mutex
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	r.mu.Lock()
+	r.bytesRead += int64(n)
+	r.mu.Unlock()
+	return n, err
+}
+
+func (r *contextReader) count() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bytesRead
+}
+
+// progressReporter calls the user's callbacks, which may be reached from several
+// decompression workers at once, one call at a time.
+type progressReporter struct {
+	fn         func(Progress)
+	warn       func(error)
+	input      *contextReader
+	totalBytes int64
+	mu         sync.Mutex
+}
+
+func (p *progressReporter) report(phase Phase, block int) {
+	if p == nil || p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fn(Progress{
+		Phase:      phase,
+		Block:      block,
+		BytesRead:  p.input.count(),
+		TotalBytes: p.totalBytes,
+	})
+}
+
+func (p *progressReporter) warning(err error) {
+	if p == nil || p.warn == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.warn(err)
+}
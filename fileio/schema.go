@@ -0,0 +1,209 @@
+package fileio
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// jsonSchema is the subset of JSON Schema (draft 2020-12) used to describe the export format.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 any                    `json:"type,omitempty"`
+	Const                any                    `json:"const,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Minimum              *int64                 `json:"minimum,omitempty"`
+	Maximum              *int64                 `json:"maximum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	PropertyNames        *jsonSchema            `json:"propertyNames,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+}
+
+// Values allowed for the string types that are used as enumerations
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(Terrain("")): enumValues(AllTerrains),
+	reflect.TypeOf(Feature("")): enumValues(AllFeatures),
+	reflect.TypeOf(Route("")):   enumValues(AllRoutes),
+}
+
+func enumValues[T ~string](values []T) []string {
+	enum := make([]string, len(values))
+	for i, value := range values {
+		enum[i] = string(value)
+	}
+	return enum
+}
+
+// Names of the definitions of the version 1 types, which are only used to import
+// that format and would otherwise be listed under their Go names
+var schemaDefNames = map[reflect.Type]string{
+	reflect.TypeOf(legacyMapJson{}): "TOAWMapJsonV1",
+	reflect.TypeOf(legacyMapData{}): "TOAWMapDataV1",
+}
+
+type schemaGenerator struct {
+	defs map[string]*jsonSchema
+	// nullableSlices allows null for slices, which encoding/json writes for nil slices.
+	// The version 1 format marshals the map data directly, so its lists can be null.
+	nullableSlices bool
+}
+
+// JsonSchema returns a JSON Schema describing the current json export format.
+// It is generated from the export types, so it always matches what ExportTOAWMapJson writes.
+// The version 1 format and the records of the ndjson format are described by
+// the TOAWMapJsonV1 and NdjsonRecord definitions.
+func JsonSchema() ([]byte, error) {
+	generator := &schemaGenerator{defs: make(map[string]*jsonSchema)}
+	root := generator.structSchema(reflect.TypeOf(TOAWMapJsonV2{}))
+	root.Schema = "https://json-schema.org/draft/2020-12/schema"
+	root.ID = "https://github.com/samuelyuan/TOAWMap/JSON_FORMAT.md"
+	root.Title = "TOAWMap json export"
+	root.Description = "Map data exported by TOAWMap with -mode=exportjson. " +
+		"The original format written with -jsonversion=1 is described by $defs/TOAWMapJsonV1 and each line of an .ndjson export by $defs/NdjsonRecord. " +
+		"See JSON_FORMAT.md for a description of each field."
+	root.Properties["schemaVersion"] = &jsonSchema{Const: JsonSchemaVersion}
+
+	generator.defs["NdjsonRecord"] = generator.ndjsonRecordSchema()
+	generator.nullableSlices = true
+	generator.schemaFor(reflect.TypeOf(legacyMapJson{}))
+	root.Defs = generator.defs
+	return json.MarshalIndent(root, "", "  ")
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) *jsonSchema {
+	if enum, ok := schemaEnums[t]; ok {
+		return &jsonSchema{Type: "string", Enum: enum}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.Struct:
+		name, ok := schemaDefNames[t]
+		if !ok {
+			name = t.Name()
+		}
+		if _, ok := g.defs[name]; !ok {
+			// Reserve the name first in case the type refers to itself
+			g.defs[name] = nil
+			g.defs[name] = g.structSchema(t)
+		}
+		return &jsonSchema{Ref: "#/$defs/" + name}
+	case reflect.Slice:
+		// encoding/json writes byte slices as base64 strings
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: g.sliceType("string"), ContentEncoding: "base64"}
+		}
+		return &jsonSchema{Type: g.sliceType("array"), Items: g.schemaFor(t.Elem())}
+	case reflect.Array:
+		// Arrays are written as lists of their elements, even byte arrays
+		length := t.Len()
+		return &jsonSchema{Type: "array", Items: g.schemaFor(t.Elem()), MinItems: &length, MaxItems: &length}
+	case reflect.Map:
+		schema := &jsonSchema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+		if enum, ok := schemaEnums[t.Key()]; ok {
+			schema.PropertyNames = &jsonSchema{Enum: enum}
+		}
+		return schema
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Uint8:
+		return integerSchema(0, 255)
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := int64(0)
+		return &jsonSchema{Type: "integer", Minimum: &minimum}
+	}
+	return &jsonSchema{}
+}
+
+func (g *schemaGenerator) sliceType(jsonType string) any {
+	if g.nullableSlices {
+		return []string{jsonType, "null"}
+	}
+	return jsonType
+}
+
+// ndjsonRecordSchema describes a line of the ndjson format, which is one of the
+// records with its record field set to the record type.
+func (g *schemaGenerator) ndjsonRecordSchema() *jsonSchema {
+	records := []struct {
+		recordType string
+		t          reflect.Type
+	}{
+		{ndjsonHeader, reflect.TypeOf(ndjsonHeaderRecord{})},
+		{ndjsonRow, reflect.TypeOf(ndjsonRowRecord{})},
+		{ndjsonLocation, reflect.TypeOf(ndjsonLocationRecord{})},
+		{ndjsonTeam, reflect.TypeOf(ndjsonTeamRecord{})},
+		{ndjsonUnit, reflect.TypeOf(ndjsonUnitRecord{})},
+	}
+	schema := &jsonSchema{}
+	for _, record := range records {
+		recordSchema := g.structSchema(record.t)
+		recordSchema.Properties["record"] = &jsonSchema{Const: record.recordType}
+		if record.recordType == ndjsonHeader {
+			recordSchema.Properties["schemaVersion"] = &jsonSchema{Const: JsonSchemaVersion}
+		}
+		schema.OneOf = append(schema.OneOf, recordSchema)
+	}
+	return schema
+}
+
+func integerSchema(minimum int64, maximum int64) *jsonSchema {
+	return &jsonSchema{Type: "integer", Minimum: &minimum, Maximum: &maximum}
+}
+
+// structSchema describes the fields the same way encoding/json names them.
+// Fields without omitempty are always written, so they are required.
+func (g *schemaGenerator) structSchema(t reflect.Type) *jsonSchema {
+	schema := &jsonSchema{
+		Type:                 "object",
+		Properties:           make(map[string]*jsonSchema),
+		AdditionalProperties: false,
+	}
+	g.addFields(schema, t, false)
+	return schema
+}
+
+// addFields adds the fields of the struct to the schema. The fields of an embedded
+// struct are hidden by fields with the same name in the outer struct, as in encoding/json.
+func (g *schemaGenerator) addFields(schema *jsonSchema, t reflect.Type, embedded bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		// encoding/json writes the fields of embedded structs without a name in the outer object
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(schema, field.Type, true)
+			continue
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; ok && embedded {
+			continue
+		}
+		schema.Properties[name] = g.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package fileio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// compileSchema compiles the definition at the json pointer in the schema from JsonSchema.
+func compileSchema(t *testing.T, pointer string) *jsonschema.Schema {
+	t.Helper()
+	schemaJson, err := JsonSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("toawmap.schema.json", bytes.NewReader(schemaJson)); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compiler.Compile("toawmap.schema.json#" + pointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func validateJson(t *testing.T, schema *jsonschema.Schema, name string, data []byte) {
+	t.Helper()
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("%s isn't valid json: %v", name, err)
+	}
+	if err := schema.Validate(document); err != nil {
+		t.Errorf("%s doesn't match the schema: %#v", name, err)
+	}
+}
+
+func TestJsonSchemaVersion2(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTOAWMapJson(&buf, mapDataWithUnits()); err != nil {
+		t.Fatal(err)
+	}
+	schema := compileSchema(t, "")
+	validateJson(t, schema, "version 2 export", buf.Bytes())
+
+	var document map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	document["units"].([]any)[0].(map[string]any)["strength"] = 10
+	if schema.Validate(document) == nil {
+		t.Error("a unit with an unknown field matches the schema")
+	}
+}
+
+func TestJsonSchemaVersion1(t *testing.T) {
+	outputFilename := filepath.Join(t.TempDir(), "map.json")
+	ExportTOAWMapJsonLegacy(mapDataWithUnits(), outputFilename)
+	data, err := os.ReadFile(outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := compileSchema(t, "/$defs/TOAWMapJsonV1")
+	validateJson(t, schema, "version 1 export", data)
+
+	// A map without any units or locations has null lists in the original format
+	emptyFilename := filepath.Join(t.TempDir(), "empty.json")
+	ExportTOAWMapJsonLegacy(syntheticMapData(3, 2, 47), emptyFilename)
+	if data, err = os.ReadFile(emptyFilename); err != nil {
+		t.Fatal(err)
+	}
+	validateJson(t, schema, "version 1 export without units", data)
+
+	// The current format isn't accepted as the original one
+	var buf bytes.Buffer
+	if err := WriteTOAWMapJson(&buf, mapDataWithUnits()); err != nil {
+		t.Fatal(err)
+	}
+	var document any
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Validate(document) == nil {
+		t.Error("version 2 export matches the version 1 schema")
+	}
+}
+
+func TestJsonSchemaNdjson(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTOAWMapNdjson(&buf, mapDataWithUnits()); err != nil {
+		t.Fatal(err)
+	}
+	schema := compileSchema(t, "/$defs/NdjsonRecord")
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(nil, 1<<20)
+	records := 0
+	for scanner.Scan() {
+		records++
+		validateJson(t, schema, "ndjson record", scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// The header, 8 rows, 1 location, 2 teams and 2 units
+	if records != 14 {
+		t.Errorf("found %d records, expected 14", records)
+	}
+
+	if schema.Validate(map[string]any{"record": "river"}) == nil {
+		t.Error("a record of an unknown type matches the schema")
+	}
+}
@@ -0,0 +1,283 @@
+package fileio
+
+// Terrain is the base terrain of a tile.
+type Terrain string
+
+const (
+	TerrainGrass        Terrain = "grass"
+	TerrainEmpty        Terrain = "empty"
+	TerrainImpassable   Terrain = "impassable"
+	TerrainDeepWater    Terrain = "deep_water"
+	TerrainShallowWater Terrain = "shallow_water"
+	TerrainMountains    Terrain = "mountains"
+	TerrainHills        Terrain = "hills"
+	TerrainSand         Terrain = "sand"
+	TerrainFloodedMarsh Terrain = "flooded_marsh"
+	TerrainMarsh        Terrain = "marsh"
+)
+
+// AllTerrains lists every terrain, in the order used to pick a tile's terrain
+// when more than one terrain flag is set. Grass is the default and comes last.
+var AllTerrains = []Terrain{
+	TerrainEmpty,
+	TerrainImpassable,
+	TerrainDeepWater,
+	TerrainShallowWater,
+	TerrainMountains,
+	TerrainHills,
+	TerrainSand,
+	TerrainFloodedMarsh,
+	TerrainMarsh,
+	TerrainGrass,
+}
+
+// Route is a kind of line feature that crosses from the center of a tile to its edges.
+type Route string
+
+const (
+	RouteDryRiver   Route = "dry_river"
+	RouteRiver      Route = "river"
+	RouteMajorRiver Route = "major_river"
+	RouteRoad       Route = "road"
+	RouteRailroad   Route = "railroad"
+)
+
+// AllRoutes lists every route in the order they are drawn.
+var AllRoutes = []Route{RouteDryRiver, RouteRiver, RouteMajorRiver, RouteRoad, RouteRailroad}
+
+// Directions from a tile to its neighbors. Route direction bits are 1 << direction.
+const (
+	DirectionNorth = iota
+	DirectionNortheast
+	DirectionSoutheast
+	DirectionSouth
+	DirectionSouthwest
+	DirectionNorthwest
+)
+
+// OppositeDirection returns the direction that points back from the neighbor.
+func OppositeDirection(direction int) int {
+	return (direction + 3) % 6
+}
+
+// Neighbor returns the coordinates of the tile next to (x, y) in the given direction.
+// The map uses columns of hexes where the odd columns are shifted up by half a hex,
+// so the row of a diagonal neighbor depends on whether the column is even or odd.
+// The result may be outside the map.
+func Neighbor(x int, y int, direction int) (int, int) {
+	// Diagonal neighbors of an odd column are half a hex higher than those of an even column
+	shift := 0
+	if x%2 != 0 {
+		shift = -1
+	}
+	switch direction {
+	case DirectionNorth:
+		return x, y - 1
+	case DirectionNortheast:
+		return x + 1, y + shift
+	case DirectionSoutheast:
+		return x + 1, y + shift + 1
+	case DirectionSouth:
+		return x, y + 1
+	case DirectionSouthwest:
+		return x - 1, y + shift + 1
+	case DirectionNorthwest:
+		return x - 1, y + shift
+	}
+	return x, y
+}
+
+// Index in the tile data where each route's direction bits are stored.
+// Bit mapping: 1=North, 2=Northeast, 4=Southeast, 8=South, 16=Southwest, 32=Northwest
+var routeIndex = map[Route]int{
+	RouteDryRiver:   21,
+	RouteRiver:      22,
+	RouteMajorRiver: 23,
+	RouteRoad:       31,
+	RouteRailroad:   33,
+}
+
+// Feature is a terrain subtype that is stored as its own flag in the tile data.
+type Feature string
+
+const (
+	FeatureArid     Feature = "arid"
+	FeatureSandy    Feature = "sandy"
+	FeatureRSandy   Feature = "r_sandy"
+	FeatureBadlands Feature = "badlands"
+	FeatureUrban1   Feature = "urban1"
+	FeatureUrban2   Feature = "urban2"
+	FeatureUrban3   Feature = "urban3"
+	FeatureUrban4   Feature = "urban4"
+	FeatureCForest  Feature = "c_forest"
+	FeatureDForest  Feature = "d_forest"
+	FeatureMForest  Feature = "m_forest"
+	FeatureTForest  Feature = "t_forest"
+)
+
+// AllFeatures lists every feature in the order of their index in the tile data.
+var AllFeatures = []Feature{
+	FeatureArid, FeatureSandy, FeatureRSandy, FeatureBadlands,
+	FeatureUrban1, FeatureUrban2, FeatureUrban3, FeatureUrban4,
+	FeatureCForest, FeatureDForest, FeatureMForest, FeatureTForest,
+}
+
+var featureIndex = map[Feature]int{
+	FeatureArid:     1,
+	FeatureSandy:    2,
+	FeatureRSandy:   3,
+	FeatureBadlands: 4,
+	FeatureUrban1:   14,
+	FeatureUrban2:   15,
+	FeatureUrban3:   16,
+	FeatureUrban4:   17,
+	FeatureCForest:  26,
+	FeatureDForest:  27,
+	FeatureMForest:  28,
+	FeatureTForest:  29,
+}
+
+// IsUrban reports whether the feature is one of the urban subtypes.
+func (f Feature) IsUrban() bool {
+	return f == FeatureUrban1 || f == FeatureUrban2 || f == FeatureUrban3 || f == FeatureUrban4
+}
+
+// IsForest reports whether the feature is one of the forest subtypes.
+func (f Feature) IsForest() bool {
+	return f == FeatureCForest || f == FeatureDForest || f == FeatureMForest || f == FeatureTForest
+}
+
+// IsEmpty reports whether the tile is outside the playable area.
+func (t TileData) IsEmpty() bool {
+	return t.Data[38]&0x10 != 0
+}
+
+func (t TileData) hasFlag(index int) bool {
+	return !t.IsEmpty() && t.Data[index] != 0
+}
+
+// Terrain returns the base terrain of the tile. Forests and urban areas are
+// features on top of the base terrain.
+func (t TileData) Terrain() Terrain {
+	switch {
+	case t.IsEmpty():
+		return TerrainEmpty
+	case t.hasFlag(7):
+		return TerrainImpassable
+	case t.hasFlag(11):
+		return TerrainDeepWater
+	case t.hasFlag(10):
+		return TerrainShallowWater
+	case t.hasFlag(6):
+		return TerrainMountains
+	case t.hasFlag(5):
+		return TerrainHills
+	case t.hasFlag(1) || t.hasFlag(2) || t.hasFlag(3) || t.hasFlag(4):
+		return TerrainSand
+	case t.hasFlag(9):
+		return TerrainFloodedMarsh
+	case t.hasFlag(8):
+		return TerrainMarsh
+	}
+	// Grass tile as default
+	return TerrainGrass
+}
+
+// Index in the tile data of each terrain flag. Sand is stored as one of the sand features.
+var terrainIndex = map[Terrain]int{
+	TerrainImpassable:   7,
+	TerrainDeepWater:    11,
+	TerrainShallowWater: 10,
+	TerrainMountains:    6,
+	TerrainHills:        5,
+	TerrainFloodedMarsh: 9,
+	TerrainMarsh:        8,
+}
+
+var sandFeatures = []Feature{FeatureArid, FeatureSandy, FeatureRSandy, FeatureBadlands}
+
+// SetTerrain changes the base terrain of the tile and leaves features and routes alone.
+// A tile that becomes sand keeps its sand feature, or is marked arid if it doesn't have one.
+// Making a tile empty only marks it as outside the playable area. Grass and unknown
+// terrains clear every terrain flag.
+func (t TileData) SetTerrain(terrain Terrain) {
+	if terrain == TerrainEmpty {
+		t.Data[38] |= 0x10
+		return
+	}
+	t.Data[38] &^= 0x10
+
+	for _, index := range terrainIndex {
+		t.Data[index] = 0
+	}
+	hasSand := false
+	for _, feature := range sandFeatures {
+		if terrain != TerrainSand {
+			t.Data[featureIndex[feature]] = 0
+		} else if t.Data[featureIndex[feature]] != 0 {
+			hasSand = true
+		}
+	}
+
+	if index, ok := terrainIndex[terrain]; ok {
+		t.Data[index] = 1
+	} else if terrain == TerrainSand && !hasSand {
+		t.Data[featureIndex[FeatureArid]] = 1
+	}
+}
+
+// HasFeature reports whether the feature flag is set on the tile.
+func (t TileData) HasFeature(feature Feature) bool {
+	return t.hasFlag(featureIndex[feature])
+}
+
+// Features returns every feature flag set on the tile.
+func (t TileData) Features() []Feature {
+	var features []Feature
+	for _, feature := range AllFeatures {
+		if t.HasFeature(feature) {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// IsUrban reports whether any of the urban flags are set.
+func (t TileData) IsUrban() bool {
+	return t.HasFeature(FeatureUrban1) || t.HasFeature(FeatureUrban2) ||
+		t.HasFeature(FeatureUrban3) || t.HasFeature(FeatureUrban4)
+}
+
+// IsForest reports whether any of the forest flags are set.
+func (t TileData) IsForest() bool {
+	return t.HasFeature(FeatureCForest) || t.HasFeature(FeatureDForest) ||
+		t.HasFeature(FeatureMForest) || t.HasFeature(FeatureTForest)
+}
+
+// SetFeature sets or clears a feature flag. A flag that is already set keeps its value.
+func (t TileData) SetFeature(feature Feature, enabled bool) {
+	index, ok := featureIndex[feature]
+	if !ok {
+		return
+	}
+	if !enabled {
+		t.Data[index] = 0
+	} else if t.Data[index] == 0 {
+		t.Data[index] = 1
+	}
+}
+
+// SetRouteMask replaces the direction bits of a route.
+func (t TileData) SetRouteMask(route Route, mask byte) {
+	if index, ok := routeIndex[route]; ok {
+		t.Data[index] = mask
+	}
+}
+
+// RouteMask returns the direction bits of the route, or zero if the tile doesn't have it.
+func (t TileData) RouteMask(route Route) byte {
+	if t.IsEmpty() {
+		return 0
+	}
+	return t.Data[routeIndex[route]]
+}
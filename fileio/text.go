@@ -0,0 +1,138 @@
+package fileio
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// CodePage is the character encoding of the text fields in scenario files.
+type CodePage string
+
+const (
+	// CodePageWindows1252 is used by the Western European versions of Windows, which
+	// the game was written for.
+	CodePageWindows1252 CodePage = "windows-1252"
+	CodePageLatin1      CodePage = "latin1"
+	// CodePageUTF8 reads fields that aren't valid UTF-8 as Windows-1252 instead.
+	CodePageUTF8 CodePage = "utf-8"
+)
+
+// AllCodePages lists the supported code pages.
+var AllCodePages = []CodePage{CodePageWindows1252, CodePageLatin1, CodePageUTF8}
+
+// Characters of Windows-1252 from 0x80 to 0x9f, where it differs from Latin-1.
+// The five bytes Windows-1252 doesn't use are kept as the control characters
+// Latin-1 has there, so every byte can be read and written back unchanged.
+var windows1252High = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+var windows1252Bytes = func() map[rune]byte {
+	table := make(map[rune]byte)
+	for i, r := range windows1252High {
+		table[r] = byte(0x80 + i)
+	}
+	return table
+}()
+
+// defaultCodePage is used for scenarios read without a code page in their ReadOptions
+// and for maps imported from other formats.
+var defaultCodePage = CodePageWindows1252
+
+// ParseCodePage returns the code page with the given name, ignoring case.
+func ParseCodePage(name string) (CodePage, error) {
+	for _, codePage := range AllCodePages {
+		if strings.EqualFold(name, string(codePage)) {
+			return codePage, nil
+		}
+	}
+	return "", fmt.Errorf("unknown code page %s, expected one of %v", name, AllCodePages)
+}
+
+// SetCodePage changes the default code page, which is Windows-1252 unless it is changed.
+// It is meant for the command line, before any map is read. Programs that read several
+// maps at once should set the code page of each in its ReadOptions instead.
+func SetCodePage(name string) error {
+	codePage, err := ParseCodePage(name)
+	if err != nil {
+		return err
+	}
+	defaultCodePage = codePage
+	return nil
+}
+
+// decodeText converts text in the code page to a string. An empty code page is Windows-1252.
+func decodeText(data []byte, codePage CodePage) string {
+	if codePage == CodePageUTF8 && utf8.Valid(data) {
+		return string(data)
+	}
+
+	var builder strings.Builder
+	for _, b := range data {
+		if b >= 0x80 && b < 0xa0 && codePage != CodePageLatin1 {
+			builder.WriteRune(windows1252High[b-0x80])
+		} else {
+			builder.WriteRune(rune(b))
+		}
+	}
+	return builder.String()
+}
+
+// EncodeWindows1252 converts s to Windows-1252 whatever the code page of the text
+// fields is. PDF uses it for text in the standard fonts.
+func EncodeWindows1252(s string) []byte {
+	return encodeText(s, CodePageWindows1252)
+}
+
+// encodeText converts s to the code page. Characters the code page doesn't have are
+// written as '?'. An empty code page is Windows-1252.
+func encodeText(s string, codePage CodePage) []byte {
+	if codePage == CodePageUTF8 {
+		return []byte(s)
+	}
+
+	data := make([]byte, 0, len(s))
+	for _, r := range s {
+		if b, ok := windows1252Bytes[r]; ok && codePage != CodePageLatin1 {
+			data = append(data, b)
+		} else if r < 0x100 && (r < 0x80 || r >= 0xa0 || codePage == CodePageLatin1) {
+			data = append(data, byte(r))
+		} else {
+			data = append(data, '?')
+		}
+	}
+	return data
+}
+
+// cString converts a fixed-size, NUL terminated field to a string.
+func cString(data []byte, codePage CodePage) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return decodeText(data, codePage)
+}
+
+// putCString copies s into a fixed-size field, truncating it if needed and
+// clearing the rest of the field. UTF-8 text is only cut between characters.
+func putCString(dst []byte, s string, codePage CodePage) {
+	data := encodeText(s, codePage)
+	if len(data) > len(dst) {
+		data = data[:len(dst)]
+		if codePage == CodePageUTF8 {
+			// Drop the start of a character that was cut off
+			for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(data[i]) {
+					if !utf8.FullRune(data[i:]) {
+						data = data[:i]
+					}
+					break
+				}
+			}
+		}
+	}
+	n := copy(dst, data)
+	clear(dst[n:])
+}
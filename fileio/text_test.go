@@ -0,0 +1,115 @@
+package fileio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	for _, codePage := range AllCodePages {
+		for _, name := range []string{"Kraków", "Düsseldorf", "Warsaw"} {
+			data := encodeText(name, codePage)
+			if decoded := decodeText(data, codePage); decoded != name {
+				t.Errorf("%s: %q is read back as %q", codePage, name, decoded)
+			}
+		}
+	}
+
+	// The accents are single bytes in the legacy code pages
+	if data := encodeText("Kraków", CodePageWindows1252); !bytes.Equal(data, []byte("Krak\xf3w")) {
+		t.Errorf("Kraków is %x in windows-1252", data)
+	}
+	if data := encodeText("Düsseldorf", CodePageLatin1); !bytes.Equal(data, []byte("D\xfcsseldorf")) {
+		t.Errorf("Düsseldorf is %x in latin1", data)
+	}
+}
+
+func TestTextHighBytes(t *testing.T) {
+	for b := 0x80; b < 0xa0; b++ {
+		data := []byte{byte(b)}
+		windows1252 := []rune(decodeText(data, CodePageWindows1252))[0]
+		latin1 := []rune(decodeText(data, CodePageLatin1))[0]
+		if latin1 != rune(b) {
+			t.Errorf("latin1 reads %#x as %U", b, latin1)
+		}
+		if windows1252 != windows1252High[b-0x80] {
+			t.Errorf("windows-1252 reads %#x as %U", b, windows1252)
+		}
+		// Every byte is written back unchanged, including the ones windows-1252 doesn't use
+		if encoded := encodeText(string(windows1252), CodePageWindows1252); !bytes.Equal(encoded, data) {
+			t.Errorf("windows-1252 writes %U as %x, expected %#x", windows1252, encoded, b)
+		}
+		if encoded := encodeText(string(latin1), CodePageLatin1); !bytes.Equal(encoded, data) {
+			t.Errorf("latin1 writes %U as %x, expected %#x", latin1, encoded, b)
+		}
+	}
+	if decoded := decodeText([]byte{0x80, 0x9f}, CodePageWindows1252); decoded != "€Ÿ" {
+		t.Errorf("windows-1252 reads 0x80 0x9f as %q", decoded)
+	}
+}
+
+func TestTextReplacement(t *testing.T) {
+	for _, test := range []struct {
+		codePage CodePage
+		text     string
+		expected string
+	}{
+		{CodePageWindows1252, "Łódź", "?\xf3d?"},
+		{CodePageLatin1, "€5", "?5"},
+		{CodePageLatin1, "Łódź", "?\xf3d?"},
+		{CodePageUTF8, "Łódź", "Łódź"},
+	} {
+		if data := encodeText(test.text, test.codePage); string(data) != test.expected {
+			t.Errorf("%s: %q is written as %q, expected %q", test.codePage, test.text, data, test.expected)
+		}
+	}
+}
+
+func TestPutCString(t *testing.T) {
+	for _, test := range []struct {
+		codePage CodePage
+		size     int
+		text     string
+		expected string
+	}{
+		// ó is two bytes in UTF-8, so it doesn't fit in the last byte
+		{CodePageUTF8, 5, "Kraków", "Krak\x00"},
+		{CodePageUTF8, 6, "Kraków", "Krak\xc3\xb3"},
+		{CodePageUTF8, 7, "Kraków", "Krak\xc3\xb3w"},
+		{CodePageWindows1252, 5, "Kraków", "Krak\xf3"},
+		{CodePageWindows1252, 8, "Kraków", "Krak\xf3w\x00\x00"},
+	} {
+		// Old contents past the text must be cleared
+		dst := bytes.Repeat([]byte{'x'}, test.size)
+		putCString(dst, test.text, test.codePage)
+		if string(dst) != test.expected {
+			t.Errorf("%s: %q in %d bytes is %q, expected %q", test.codePage, test.text, test.size, dst, test.expected)
+		}
+	}
+}
+
+// Maps read with different code pages keep their own, so the same bytes are read
+// as different names.
+func TestNameStringCodePage(t *testing.T) {
+	var location LocationData
+	copy(location.Name[:], "Gda\xf1sk\x80")
+	if name := location.NameString(CodePageWindows1252); name != "Gdañsk€" {
+		t.Errorf("windows-1252 name is %q", name)
+	}
+	if name := location.NameString(CodePageLatin1); name != "Gdañsk\u0080" {
+		t.Errorf("latin1 name is %q", name)
+	}
+	if name := location.NameString(CodePageUTF8); name != "Gdañsk€" {
+		t.Errorf("utf-8 name is %q, expected the windows-1252 fallback", name)
+	}
+
+	if codePage := (ReadOptions{CodePage: CodePageLatin1}).codePage(); codePage != CodePageLatin1 {
+		t.Errorf("read options use %s, expected latin1", codePage)
+	}
+	if codePage, err := ParseCodePage("UTF-8"); err != nil || codePage != CodePageUTF8 {
+		t.Errorf("UTF-8 is parsed as %q, %v", codePage, err)
+	}
+	if _, err := ParseCodePage("koi8-r"); err == nil {
+		t.Error("koi8-r is accepted")
+	}
+}
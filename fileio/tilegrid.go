@@ -0,0 +1,225 @@
+package fileio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// TileGrid stores every tile of a map in one contiguous byte slab.
+// Tiles are laid out column by column, the same way the scenario file stores them,
+// so tile (x, y) starts at byte (x*height + y) * tileSize.
+// A nil grid has no tiles, which is what a json file without tiles is imported as.
+type TileGrid struct {
+	width    int
+	height   int
+	tileSize int
+	data     []byte
+}
+
+// NewTileGrid creates an empty grid of width x height tiles, each tileSize bytes long.
+func NewTileGrid(width int, height int, tileSize int) *TileGrid {
+	return &TileGrid{
+		width:    width,
+		height:   height,
+		tileSize: tileSize,
+		data:     make([]byte, width*height*tileSize),
+	}
+}
+
+func (g *TileGrid) Width() int {
+	if g == nil {
+		return 0
+	}
+	return g.width
+}
+
+func (g *TileGrid) Height() int {
+	if g == nil {
+		return 0
+	}
+	return g.height
+}
+
+// TileSize returns the length of a tile record, 47 bytes for TOAW3 or earlier and 48 bytes for TOAW4.
+func (g *TileGrid) TileSize() int {
+	if g == nil {
+		return 0
+	}
+	return g.tileSize
+}
+
+// Bytes returns the underlying slab.
+func (g *TileGrid) Bytes() []byte {
+	if g == nil {
+		return nil
+	}
+	return g.data
+}
+
+// Contains reports whether column x and row y are inside the grid.
+func (g *TileGrid) Contains(x int, y int) bool {
+	return x >= 0 && y >= 0 && x < g.Width() && y < g.Height()
+}
+
+// At returns a view of the tile at column x and row y.
+// The view shares memory with the grid, so changes to its data are written to the grid.
+// It panics if the tile is outside the grid, since the offset of a row past the end
+// of a column would point into the next column.
+func (g *TileGrid) At(x int, y int) TileData {
+	if !g.Contains(x, y) {
+		panic(fmt.Sprintf("tile (%d, %d) is outside the %dx%d grid", x, y, g.Width(), g.Height()))
+	}
+	offset := (x*g.height + y) * g.tileSize
+	return TileData{
+		Data: g.data[offset : offset+g.tileSize : offset+g.tileSize],
+	}
+}
+
+// NewTileGridFromBytes creates a grid that uses data as its slab.
+// The data must be laid out column by column and hold exactly width x height tiles.
+func NewTileGridFromBytes(width int, height int, tileSize int, data []byte) (*TileGrid, error) {
+	if len(data) != width*height*tileSize {
+		return nil, fmt.Errorf("tile data is %d bytes, expected %d for %dx%d tiles of %d bytes", len(data), width*height*tileSize, width, height, tileSize)
+	}
+	return &TileGrid{
+		width:    width,
+		height:   height,
+		tileSize: tileSize,
+		data:     data,
+	}, nil
+}
+
+// Row copies the tiles of row y into dst in order of increasing x and returns it.
+// A new slice is allocated if dst is too small.
+func (g *TileGrid) Row(y int, dst []byte) []byte {
+	rowSize := g.width * g.tileSize
+	if cap(dst) < rowSize {
+		dst = make([]byte, rowSize)
+	}
+	dst = dst[:rowSize]
+	for x := 0; x < g.width; x++ {
+		copy(dst[x*g.tileSize:(x+1)*g.tileSize], g.At(x, y).Data)
+	}
+	return dst
+}
+
+// SetRow overwrites the tiles of row y with src, which is laid out like the result of Row.
+func (g *TileGrid) SetRow(y int, src []byte) error {
+	if len(src) != g.width*g.tileSize {
+		return fmt.Errorf("row is %d bytes, expected %d", len(src), g.width*g.tileSize)
+	}
+	for x := 0; x < g.width; x++ {
+		copy(g.At(x, y).Data, src[x*g.tileSize:(x+1)*g.tileSize])
+	}
+	return nil
+}
+
+// Each calls fn for every tile, row by row.
+func (g *TileGrid) Each(fn func(x int, y int, tileData TileData)) {
+	for y := 0; y < g.Height(); y++ {
+		for x := 0; x < g.Width(); x++ {
+			fn(x, y, g.At(x, y))
+		}
+	}
+}
+
+// MarshalJSON writes the grid in the same shape as the original [][]*TileData,
+// a list of rows where each tile is an object with its base64 encoded data.
+// This is the version 1 json format, which older files and tools use, so every tile
+// keeps its own base64 string. The version 2 formats write a row at a time instead.
+func (g *TileGrid) MarshalJSON() ([]byte, error) {
+	const tilePrefix, tileSuffix = `{"Data":"`, `"}`
+	encodedTileSize := base64.StdEncoding.EncodedLen(g.tileSize)
+	var buf bytes.Buffer
+	buf.Grow(2 + g.height*(3+g.width*(len(tilePrefix)+encodedTileSize+len(tileSuffix)+1)))
+
+	// A tile that is a multiple of 3 bytes long encodes to the same characters on its own
+	// as inside its row, so the row is encoded at once and split. 47 byte tiles aren't.
+	row := make([]byte, g.width*g.tileSize)
+	encodedRow := make([]byte, g.width*encodedTileSize)
+	splitRow := g.tileSize%3 == 0
+	buf.WriteByte('[')
+	for y := 0; y < g.height; y++ {
+		if y > 0 {
+			buf.WriteByte(',')
+		}
+		row = g.Row(y, row)
+		if splitRow {
+			base64.StdEncoding.Encode(encodedRow, row)
+		}
+		buf.WriteByte('[')
+		for x := 0; x < g.width; x++ {
+			if x > 0 {
+				buf.WriteByte(',')
+			}
+			encodedTile := encodedRow[x*encodedTileSize : (x+1)*encodedTileSize]
+			if !splitRow {
+				base64.StdEncoding.Encode(encodedTile, row[x*g.tileSize:(x+1)*g.tileSize])
+			}
+			buf.WriteString(tilePrefix)
+			buf.Write(encodedTile)
+			buf.WriteString(tileSuffix)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads the list of rows written by MarshalJSON.
+func (g *TileGrid) UnmarshalJSON(data []byte) error {
+	var rows [][]*TileData
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	// The rows must all be as wide as the first one
+	v := &validator{}
+	if len(rows) > 0 {
+		v.checkTileRows("AllTileData", rows, len(rows[0]), "the first row")
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+	grid, err := newTileGridFromRows(rows)
+	if err != nil {
+		return err
+	}
+	*g = *grid
+	return nil
+}
+
+// newTileGridFromRows copies the rows into a grid. Rows that are all empty give an
+// empty grid, otherwise every row must have the tiles of the first row.
+func newTileGridFromRows(rows [][]*TileData) (*TileGrid, error) {
+	empty := true
+	for _, row := range rows {
+		if len(row) > 0 {
+			empty = false
+			break
+		}
+	}
+	if empty {
+		return &TileGrid{}, nil
+	}
+	if len(rows[0]) == 0 {
+		return nil, fmt.Errorf("row 0 has no tiles, but other rows do")
+	}
+	if rows[0][0] == nil || !isValidTileSize(len(rows[0][0].Data)) {
+		return nil, fmt.Errorf("tile (0, 0) is not 47 or 48 bytes")
+	}
+	grid := NewTileGrid(len(rows[0]), len(rows), len(rows[0][0].Data))
+	for y, row := range rows {
+		if len(row) != grid.width {
+			return nil, fmt.Errorf("row %d has %d tiles, expected %d", y, len(row), grid.width)
+		}
+		for x, tileData := range row {
+			if tileData == nil || len(tileData.Data) != grid.tileSize {
+				return nil, fmt.Errorf("tile (%d, %d) is not %d bytes", x, y, grid.tileSize)
+			}
+			copy(grid.At(x, y).Data, tileData.Data)
+		}
+	}
+	return grid, nil
+}
@@ -0,0 +1,209 @@
+package fileio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// syntheticMapData returns a map with bands of every terrain and a road and river
+// crossing every row, like a large TOAW4 scenario without units.
+func syntheticMapData(width int, height int, tileSize int) *TOAWMapData {
+	grid := NewTileGrid(width, height, tileSize)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tileData := grid.At(x, y)
+			tileData.SetTerrain(AllTerrains[(x/7+y/5)%len(AllTerrains)])
+			if x%10 == 0 {
+				tileData.SetRouteMask(RouteRoad, 1<<DirectionNorth|1<<DirectionSouth)
+			}
+			if y%12 == 0 {
+				tileData.SetRouteMask(RouteRiver, 1<<DirectionNortheast|1<<DirectionSouthwest)
+			}
+		}
+	}
+	return &TOAWMapData{
+		Version:         4,
+		AllTileData:     grid,
+		AllTeamNameData: []*TeamNameData{{}, {}},
+		MapWidth:        width,
+		MapHeight:       height,
+	}
+}
+
+func TestTileGridAtOutside(t *testing.T) {
+	grid := NewTileGrid(3, 2, 47)
+	for _, position := range [][2]int{{0, 2}, {3, 0}, {-1, 0}, {0, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("At(%d, %d) didn't panic", position[0], position[1])
+				}
+			}()
+			grid.At(position[0], position[1])
+		}()
+	}
+}
+
+func TestTileGridMarshalJSON(t *testing.T) {
+	for _, tileSize := range []int{47, 48} {
+		grid := syntheticMapData(9, 4, tileSize).AllTileData
+		data, err := json.Marshal(grid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every tile has its own base64 string, as when [][]*TileData was marshaled
+		var rows [][]struct{ Data string }
+		if err := json.Unmarshal(data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		for y, row := range rows {
+			for x, tile := range row {
+				if expected := base64.StdEncoding.EncodeToString(grid.At(x, y).Data); tile.Data != expected {
+					t.Fatalf("tile (%d, %d) of %d bytes is %s, expected %s", x, y, tileSize, tile.Data, expected)
+				}
+			}
+		}
+
+		var decoded TileGrid
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Bytes(), grid.Bytes()) {
+			t.Errorf("grid of %d byte tiles changed after a round trip", tileSize)
+		}
+	}
+}
+
+func TestTileGridFromRows(t *testing.T) {
+	tile := func(size int) *TileData { return &TileData{Data: make([]byte, size)} }
+	for _, rows := range [][][]*TileData{nil, {}, {{}}, {{}, {}}} {
+		grid, err := newTileGridFromRows(rows)
+		if err != nil || grid.Width() != 0 || grid.Height() != 0 {
+			t.Errorf("%d empty rows give a %dx%d grid, %v", len(rows), grid.Width(), grid.Height(), err)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		rows [][]*TileData
+	}{
+		{"empty first row", [][]*TileData{{}, {tile(48)}}},
+		{"missing first tile", [][]*TileData{{nil, tile(48)}, {tile(48), tile(48)}}},
+		{"short row", [][]*TileData{{tile(48), tile(48)}, {tile(48)}}},
+		{"long row", [][]*TileData{{tile(48)}, {tile(48), tile(48)}}},
+		{"missing tile", [][]*TileData{{tile(48)}, {nil}}},
+		{"tile size", [][]*TileData{{tile(46)}}},
+		{"mixed tile sizes", [][]*TileData{{tile(48), tile(47)}}},
+	} {
+		if _, err := newTileGridFromRows(test.rows); err == nil {
+			t.Errorf("%s: rows were accepted", test.name)
+		}
+		// The json rows get the same checks as the version 1 format, with the path of each problem
+		data, err := json.Marshal(test.rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var grid TileGrid
+		err = json.Unmarshal(data, &grid)
+		if err == nil {
+			t.Errorf("%s: json rows were accepted", test.name)
+		} else if !strings.HasPrefix(err.Error(), "AllTileData[") {
+			t.Errorf("%s: error is %v, expected the path of the tile", test.name, err)
+		}
+	}
+
+	var grid TileGrid
+	if err := json.Unmarshal([]byte(`[[{"Data":"AAAA"}]]`), &grid); err == nil || err.Error() != "AllTileData[0][0].Data: tile record is 3 bytes, expected 47 or 48" {
+		t.Errorf("error is %v", err)
+	}
+}
+
+func BenchmarkGetTileData(b *testing.B) {
+	mapBlock := make([]byte, 48*700*700)
+	for i := range mapBlock {
+		mapBlock[i] = byte(i)
+	}
+	b.SetBytes(int64(len(mapBlock)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GetTileData(mapBlock, 700, 700)
+	}
+}
+
+func BenchmarkMarshalTileGrid(b *testing.B) {
+	grid := syntheticMapData(700, 700, 48).AllTileData
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := grid.MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteTOAWMapJson(b *testing.B) {
+	mapData := syntheticMapData(700, 700, 48)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteTOAWMapJson(io.Discard, mapData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadTOAWMapJson(b *testing.B) {
+	var buf bytes.Buffer
+	if err := WriteTOAWMapJson(&buf, syntheticMapData(700, 700, 48)); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(buf.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadTOAWMapJson(bytes.NewReader(buf.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTileGridNil(t *testing.T) {
+	var grid *TileGrid
+	if grid.Width() != 0 || grid.Height() != 0 || grid.TileSize() != 0 || grid.Bytes() != nil {
+		t.Error("a nil grid isn't empty")
+	}
+	if grid.Contains(0, 0) {
+		t.Error("a nil grid contains tile (0, 0)")
+	}
+	grid.Each(func(x int, y int, tileData TileData) {
+		t.Errorf("a nil grid has tile (%d, %d)", x, y)
+	})
+}
+
+// A map without tiles is exported in every json format and imported with a nil grid.
+func TestExportWithoutTilesRoundTrip(t *testing.T) {
+	mapData := &TOAWMapData{Version: 4, AllTeamNameData: []*TeamNameData{{}, {}}, MapWidth: 3, MapHeight: 2}
+	dir := t.TempDir()
+	for _, name := range []string{"map.json", "map.ndjson", "legacy.json"} {
+		outputFilename := filepath.Join(dir, name)
+		if name == "legacy.json" {
+			ExportTOAWMapJsonLegacy(mapData, outputFilename)
+		} else {
+			ExportTOAWMapJson(mapData, outputFilename)
+		}
+		imported, err := ImportTOAWMapDataFromJson(outputFilename)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if imported.AllTileData != nil {
+			t.Errorf("%s: expected a map without a tile grid", name)
+		}
+		if imported.MapWidth != 3 || imported.MapHeight != 2 {
+			t.Errorf("%s: map is %dx%d, expected 3x2", name, imported.MapWidth, imported.MapHeight)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package fileio
+
+import "strings"
+
+// Empty location slots and units that aren't on the map use this coordinate.
+const OffMapCoordinate = 999
+
+// NameString returns the location name without the trailing NUL bytes.
+func (l LocationData) NameString(codePage CodePage) string {
+	return cString(l.Name[:], codePage)
+}
+
+// IsEmpty reports whether the location slot is unused.
+func (l LocationData) IsEmpty() bool {
+	return l.X == OffMapCoordinate
+}
+
+// NameString returns the unit name without the trailing NUL bytes.
+func (u *UnitData) NameString(codePage CodePage) string {
+	return cString(u.Name[:], codePage)
+}
+
+// IsOnMap reports whether the unit has been placed on the map.
+func (u *UnitData) IsOnMap() bool {
+	return u.X != OffMapCoordinate && u.Y != OffMapCoordinate
+}
+
+// ColorGroup returns the color group of the unit, which is used to tell the forces apart.
+func (u *UnitData) ColorGroup() int {
+	return int((u.UnitColorAndType + ((u.UnitColorAndType >> 31) & 0x7f)) >> 7)
+}
+
+// UnitType returns the unit type stored in the low bits of UnitColorAndType.
+func (u *UnitData) UnitType() int {
+	return int(u.UnitColorAndType & 0x8000007f)
+}
+
+// SetColorGroupAndType packs the color group and unit type back into UnitColorAndType.
+func (u *UnitData) SetColorGroupAndType(colorGroup int, unitType int) {
+	u.UnitColorAndType = uint32(colorGroup)<<7 | uint32(unitType)&0x7f
+}
+
+// CountryNameString returns the country name without the trailing NUL bytes.
+func (t *TeamNameData) CountryNameString(codePage CodePage) string {
+	return cString(t.CountryName[:], codePage)
+}
+
+// ForceNameString returns the force name without the trailing NUL bytes.
+func (t *TeamNameData) ForceNameString(codePage CodePage) string {
+	return cString(t.ForceName[:], codePage)
+}
+
+// SideName returns the force and country of the side, like "Eighth Army (USA)",
+// or whichever of them is set. It is empty if neither is.
+func (t *TeamNameData) SideName(codePage CodePage) string {
+	force, country := strings.TrimSpace(t.ForceNameString(codePage)), strings.TrimSpace(t.CountryNameString(codePage))
+	if force != "" && country != "" {
+		return force + " (" + country + ")"
+	}
+	return force + country
+}
+
+// TitleString returns the map title as a string.
+func (h *TOAWMapHeader) TitleString(codePage CodePage) string {
+	return cString(h.MapTitle[:], codePage)
+}
@@ -0,0 +1,222 @@
+package fileio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a problem with one value in an imported file.
+type ValidationError struct {
+	// Path is the location of the value in the file, for example MapData.AllTileData[12][40]
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is returned when an imported file has one or more problems.
+type ValidationErrors []*ValidationError
+
+// Only the first few problems are listed in the error message
+const maxListedValidationErrors = 20
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, maxListedValidationErrors+1)
+	for i, err := range errs {
+		if i == maxListedValidationErrors {
+			lines = append(lines, fmt.Sprintf("and %d more problems", len(errs)-i))
+			break
+		}
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) addError(path string, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func isValidTileSize(tileSize int) bool {
+	return tileSize == 47 || tileSize == 48
+}
+
+func (v *validator) checkDimensions(widthPath string, heightPath string, mapWidth int, mapHeight int) bool {
+	ok := true
+	if mapWidth <= 0 || mapWidth > toaw4MaxMapSize {
+		v.addError(widthPath, "map width %d must be between 1 and %d", mapWidth, toaw4MaxMapSize)
+		ok = false
+	}
+	if mapHeight <= 0 || mapHeight > toaw4MaxMapSize {
+		v.addError(heightPath, "map height %d must be between 1 and %d", mapHeight, toaw4MaxMapSize)
+		ok = false
+	}
+	return ok
+}
+
+func (v *validator) checkCoordinates(path string, x int, y int, mapWidth int, mapHeight int) {
+	if x < 0 || x >= mapWidth || y < 0 || y >= mapHeight {
+		v.addError(path, "coordinates (%d, %d) are outside the %dx%d map", x, y, mapWidth, mapHeight)
+	}
+}
+
+// checkTileRows checks that every row has width tiles and every tile record has the
+// same valid size. widthName says where the width comes from.
+func (v *validator) checkTileRows(path string, rows [][]*TileData, width int, widthName string) {
+	tileSize := 0
+	for y, row := range rows {
+		rowPath := fmt.Sprintf("%s[%d]", path, y)
+		if len(row) != width {
+			v.addError(rowPath, "has %d tiles, expected %d to match %s", len(row), width, widthName)
+		}
+		for x, tileData := range row {
+			tilePath := fmt.Sprintf("%s[%d]", rowPath, x)
+			if tileData == nil {
+				v.addError(tilePath, "missing")
+				continue
+			}
+			if !isValidTileSize(len(tileData.Data)) {
+				v.addError(tilePath+".Data", "tile record is %d bytes, expected 47 or 48", len(tileData.Data))
+				continue
+			}
+			if tileSize == 0 {
+				tileSize = len(tileData.Data)
+			} else if len(tileData.Data) != tileSize {
+				v.addError(tilePath+".Data", "tile record is %d bytes, but earlier tiles are %d bytes", len(tileData.Data), tileSize)
+			}
+		}
+	}
+}
+
+// validateLegacyMapJson checks the original json format, which stores tiles as a list of rows.
+func validateLegacyMapJson(mapJson *legacyMapJson) error {
+	v := &validator{}
+	mapData := mapJson.MapData
+	if mapData == nil {
+		v.addError("MapData", "missing")
+		return v.err()
+	}
+	if !v.checkDimensions("MapData.MapWidth", "MapData.MapHeight", mapData.MapWidth, mapData.MapHeight) {
+		return v.err()
+	}
+
+	// A map without tiles is exported with null tiles and imported with a nil grid
+	if len(mapData.AllTileData) > 0 && len(mapData.AllTileData) != mapData.MapHeight {
+		v.addError("MapData.AllTileData", "has %d rows, expected %d to match MapHeight", len(mapData.AllTileData), mapData.MapHeight)
+	}
+	v.checkTileRows("MapData.AllTileData", mapData.AllTileData, mapData.MapWidth, "MapWidth")
+
+	for i, location := range mapData.AllLocationData {
+		if location.IsEmpty() {
+			continue
+		}
+		v.checkCoordinates(fmt.Sprintf("MapData.AllLocationData[%d]", i), int(location.X), int(location.Y), mapData.MapWidth, mapData.MapHeight)
+	}
+	for i, teamNameData := range mapData.AllTeamNameData {
+		if teamNameData == nil {
+			v.addError(fmt.Sprintf("MapData.AllTeamNameData[%d]", i), "missing")
+		}
+	}
+	for i, unitData := range mapData.AllUnitData {
+		unitPath := fmt.Sprintf("MapData.AllUnitData[%d]", i)
+		if unitData == nil {
+			v.addError(unitPath, "missing")
+			continue
+		}
+		if unitData.IsOnMap() {
+			v.checkCoordinates(unitPath, int(unitData.X), int(unitData.Y), mapData.MapWidth, mapData.MapHeight)
+		}
+	}
+	return v.err()
+}
+
+// checkTileRow checks one row of the version 2 format. Rows are also checked
+// one at a time while streaming, so seenRows is kept by the caller.
+func (v *validator) checkTileRow(rowPath string, row *TileRowJson, info MapInfoJson, seenRows map[int]bool) {
+	if row.Y < 0 || row.Y >= info.Height {
+		v.addError(rowPath+".y", "row %d is outside the map", row.Y)
+	} else if seenRows[row.Y] {
+		v.addError(rowPath+".y", "row %d appears more than once", row.Y)
+	}
+	seenRows[row.Y] = true
+	if len(row.Raw) != info.Width*info.TileSize {
+		v.addError(rowPath+".raw", "has %d bytes, expected %d for %d tiles of %d bytes", len(row.Raw), info.Width*info.TileSize, info.Width, info.TileSize)
+	}
+	if row.Tiles != nil && len(row.Tiles) != info.Width {
+		v.addError(rowPath+".tiles", "has %d tiles, expected %d to match map.width", len(row.Tiles), info.Width)
+	}
+}
+
+// Validate checks the version 2 json format before it is converted to map data.
+// The problems are returned as ValidationErrors.
+func (mapJson *TOAWMapJsonV2) Validate() error {
+	v := &validator{}
+	info := mapJson.Map
+	if !v.checkDimensions("map.width", "map.height", info.Width, info.Height) {
+		return v.err()
+	}
+	if info.LocationSlots < 0 {
+		v.addError("map.locationSlots", "must not be negative")
+	}
+	if info.UnitSlots < 0 {
+		v.addError("map.unitSlots", "must not be negative")
+	}
+
+	if len(mapJson.Tiles) > 0 {
+		if !isValidTileSize(info.TileSize) {
+			v.addError("map.tileSize", "tile record is %d bytes, expected 47 or 48", info.TileSize)
+			return v.err()
+		}
+		if len(mapJson.Tiles) != info.Height {
+			v.addError("tiles", "has %d rows, expected %d to match map.height", len(mapJson.Tiles), info.Height)
+		}
+	}
+	seenRows := make(map[int]bool)
+	for i, row := range mapJson.Tiles {
+		v.checkTileRow(fmt.Sprintf("tiles[%d]", i), &row, info, seenRows)
+	}
+
+	seenLocations := make(map[int]bool)
+	for i, location := range mapJson.Locations {
+		locationPath := fmt.Sprintf("locations[%d]", i)
+		if location.Index < 0 || location.Index >= info.LocationSlots {
+			v.addError(locationPath+".index", "index %d is outside the location table of %d slots", location.Index, info.LocationSlots)
+		} else if seenLocations[location.Index] {
+			v.addError(locationPath+".index", "index %d appears more than once", location.Index)
+		}
+		seenLocations[location.Index] = true
+		v.checkCoordinates(locationPath, location.X, location.Y, info.Width, info.Height)
+	}
+
+	seenUnits := make(map[int]bool)
+	for i, unit := range mapJson.Units {
+		unitPath := fmt.Sprintf("units[%d]", i)
+		if unit.Index < 0 || unit.Index >= info.UnitSlots {
+			v.addError(unitPath+".index", "index %d is outside the unit table of %d slots", unit.Index, info.UnitSlots)
+		} else if seenUnits[unit.Index] {
+			v.addError(unitPath+".index", "index %d appears more than once", unit.Index)
+		}
+		seenUnits[unit.Index] = true
+		if (unit.X == nil) != (unit.Y == nil) {
+			v.addError(unitPath, "x and y must both be set or both be left out")
+		} else if unit.X != nil {
+			v.checkCoordinates(unitPath, *unit.X, *unit.Y, info.Width, info.Height)
+		}
+		if unit.NextUnitOnSameTile != nil && (*unit.NextUnitOnSameTile < 0 || *unit.NextUnitOnSameTile >= info.UnitSlots) {
+			v.addError(unitPath+".nextUnitOnSameTile", "index %d is outside the unit table of %d slots", *unit.NextUnitOnSameTile, info.UnitSlots)
+		}
+	}
+	return v.err()
+}
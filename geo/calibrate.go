@@ -0,0 +1,206 @@
+package geo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+const earthRadiusKm = 6371.0
+
+// ControlPoint is the real position of a named location on the map.
+type ControlPoint struct {
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// Residual describes how well the fitted georeference matches a control point.
+type Residual struct {
+	ControlPoint
+	X int
+	Y int
+	// FitLat and FitLon are where the georeference puts the location
+	FitLat  float64
+	FitLon  float64
+	ErrorKm float64
+	// Outlier is set when the location is too far from its real position to be used in the fit
+	Outlier bool
+}
+
+// ReadControlPoints reads control points as csv with the columns name, lat and lon.
+// A header row is skipped if the lat column isn't a number.
+func ReadControlPoints(r io.Reader) ([]ControlPoint, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var controlPoints []ControlPoint
+	for i, record := range records {
+		lat, latErr := strconv.ParseFloat(record[1], 64)
+		if i == 0 && latErr != nil {
+			continue
+		}
+		lon, lonErr := strconv.ParseFloat(record[2], 64)
+		if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("line %d: invalid position %s,%s", i+1, record[1], record[2])
+		}
+		controlPoints = append(controlPoints, ControlPoint{Name: strings.TrimSpace(record[0]), Lat: lat, Lon: lon})
+	}
+	return controlPoints, nil
+}
+
+// LoadControlPoints reads a control point csv file.
+func LoadControlPoints(filename string) ([]ControlPoint, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control points: %w", err)
+	}
+	defer file.Close()
+
+	controlPoints, err := ReadControlPoints(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read control points %s: %w", filename, err)
+	}
+	return controlPoints, nil
+}
+
+// DistanceKm returns the great circle distance between two positions.
+func DistanceKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLon := (lon2 - lon1) * toRadians
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// hexSizeKm measures the distance between neighboring hex centers near hex (0, 0).
+func (g *Georeference) hexSizeKm() float64 {
+	lon1, lat1 := g.HexLonLat(0, 0)
+	lon2, lat2 := g.HexLonLat(0, 1)
+	lon3, lat3 := g.HexLonLat(1, 1)
+	return (DistanceKm(lat1, lon1, lat2, lon2) + DistanceKm(lat2, lon2, lat3, lon3)) / 2
+}
+
+// fitAffine finds the transform that minimizes the squared error at the control points.
+func fitAffine(planePoints [][2]float64, controlPoints []ControlPoint) (*Georeference, error) {
+	// Normal equations for both the longitude and the latitude rows of the transform
+	var m [3][3]float64
+	var lonRhs, latRhs [3]float64
+	for i, p := range planePoints {
+		v := [3]float64{p[0], p[1], 1}
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				m[r][c] += v[r] * v[c]
+			}
+			lonRhs[r] += v[r] * controlPoints[i].Lon
+			latRhs[r] += v[r] * controlPoints[i].Lat
+		}
+	}
+
+	det := determinant(m)
+	// Compared to the diagonal so rounding errors on large maps don't matter
+	if math.Abs(det) <= 1e-12*m[0][0]*m[1][1]*m[2][2] {
+		return nil, fmt.Errorf("control points must not all be on one line")
+	}
+	lon := solve(m, lonRhs, det)
+	lat := solve(m, latRhs, det)
+	georef := &Georeference{Transform: [6]float64{lon[0], lon[1], lon[2], lat[0], lat[1], lat[2]}}
+	georef.HexSizeKm = georef.hexSizeKm()
+	return georef, nil
+}
+
+func determinant(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// solve uses Cramer's rule, which is fine for a 3x3 system
+func solve(m [3][3]float64, rhs [3]float64, det float64) [3]float64 {
+	var result [3]float64
+	for c := 0; c < 3; c++ {
+		replaced := m
+		for r := 0; r < 3; r++ {
+			replaced[r][c] = rhs[r]
+		}
+		result[c] = determinant(replaced) / det
+	}
+	return result
+}
+
+// Calibrate fits a georeference to the locations named by the control points.
+// Names are matched without case. Locations more than maxErrorHexes hexes from their
+// real position are flagged as outliers and the fit is repeated without them,
+// as long as at least three control points are left.
+func Calibrate(mapData *fileio.TOAWMapData, controlPoints []ControlPoint, maxErrorHexes float64) (*Georeference, []Residual, error) {
+	residuals := make([]Residual, 0, len(controlPoints))
+	for _, controlPoint := range controlPoints {
+		found := false
+		for _, locationData := range mapData.AllLocationData {
+			if !locationData.IsEmpty() && strings.EqualFold(strings.TrimSpace(locationData.NameString(mapData.CodePage)), controlPoint.Name) {
+				residuals = append(residuals, Residual{ControlPoint: controlPoint, X: int(locationData.X), Y: int(locationData.Y)})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("location %q is not on the map", controlPoint.Name)
+		}
+	}
+	if len(residuals) < 3 {
+		return nil, nil, fmt.Errorf("at least 3 control points are needed, got %d", len(residuals))
+	}
+
+	fit := func(useOutliers bool) (*Georeference, error) {
+		var planePoints [][2]float64
+		var used []ControlPoint
+		for _, residual := range residuals {
+			if residual.Outlier && !useOutliers {
+				continue
+			}
+			px, py := HexCenter(residual.X, residual.Y)
+			planePoints = append(planePoints, [2]float64{px, py})
+			used = append(used, residual.ControlPoint)
+		}
+		return fitAffine(planePoints, used)
+	}
+	measure := func(georef *Georeference) int {
+		outliers := 0
+		for i := range residuals {
+			residual := &residuals[i]
+			residual.FitLon, residual.FitLat = georef.HexLonLat(residual.X, residual.Y)
+			residual.ErrorKm = DistanceKm(residual.Lat, residual.Lon, residual.FitLat, residual.FitLon)
+			residual.Outlier = residual.ErrorKm > maxErrorHexes*georef.HexSizeKm
+			if residual.Outlier {
+				outliers++
+			}
+		}
+		return outliers
+	}
+
+	georef, err := fit(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	outliers := measure(georef)
+	if outliers > 0 && len(residuals)-outliers >= 3 {
+		refit, err := fit(false)
+		if err == nil {
+			georef = refit
+			measure(georef)
+		}
+	}
+	return georef, residuals, nil
+}
@@ -0,0 +1,62 @@
+package geo
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// A version 2 json file may leave out the tiles, so the map has no tile grid.
+func TestExportWithoutTiles(t *testing.T) {
+	mapData, err := fileio.DecodeTOAWMapJson([]byte(`{
+		"schemaVersion": 2,
+		"metadata": {"version": 4},
+		"map": {"width": 3, "height": 2, "tileSize": 48, "locationSlots": 1},
+		"tiles": [],
+		"locations": [{"index": 0, "name": "Warsaw", "x": 1, "y": 1}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapData.AllTileData != nil {
+		t.Fatal("expected a map without a tile grid")
+	}
+
+	georef := NewGeoreference(52, 21, 10, 0)
+	if err := WriteGeoJSON(io.Discard, mapData, georef); err != nil {
+		t.Error(err)
+	}
+	if err := WriteKML(io.Discard, mapData, georef, "No tiles"); err != nil {
+		t.Error(err)
+	}
+}
+
+// Every style used in the KML document must be defined, including the style of units
+// in color groups without a palette color.
+func TestKMLStyles(t *testing.T) {
+	allTileData := fileio.NewTileGrid(3, 2, 48)
+	allTileData.Each(func(x int, y int, tileData fileio.TileData) {
+		tileData.SetTerrain(fileio.AllTerrains[(x+y)%len(fileio.AllTerrains)])
+	})
+	allUnitData := make([]*fileio.UnitData, 2)
+	for i, group := range []int{0, 1} {
+		allUnitData[i] = &fileio.UnitData{X: int32(i), Y: 1}
+		allUnitData[i].SetColorGroupAndType(group, 3)
+	}
+	mapData := &fileio.TOAWMapData{Version: 4, AllTileData: allTileData, AllUnitData: allUnitData, MapWidth: 3, MapHeight: 2}
+
+	var buf bytes.Buffer
+	if err := WriteKML(&buf, mapData, NewGeoreference(52, 21, 10, 0), "Styles"); err != nil {
+		t.Fatal(err)
+	}
+	document := buf.String()
+	for _, match := range regexp.MustCompile(`<styleUrl>#([^<]+)</styleUrl>`).FindAllStringSubmatch(document, -1) {
+		if !strings.Contains(document, `<Style id="`+match[1]+`">`) {
+			t.Errorf("style %s is used but not defined", match[1])
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package geo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+type geoJsonGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type geoJsonFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJsonGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Coordinates are rounded to about 10 cm, which keeps the output small
+func roundCoordinate(value float64) float64 {
+	return math.Round(value*1e6) / 1e6
+}
+
+func (g *Georeference) position(px float64, py float64) [2]float64 {
+	lon, lat := g.ToLonLat(px, py)
+	return [2]float64{roundCoordinate(lon), roundCoordinate(lat)}
+}
+
+func (g *Georeference) hexPolygon(x int, y int) [][][2]float64 {
+	corners := HexCorners(HexCenter(x, y))
+	// GeoJSON rings are closed and go counterclockwise, so walk the corners backwards
+	ring := make([][2]float64, 0, len(corners)+1)
+	for i := len(corners) - 1; i >= 0; i-- {
+		ring = append(ring, g.position(corners[i][0], corners[i][1]))
+	}
+	ring = append(ring, ring[0])
+	return [][][2]float64{ring}
+}
+
+// routeLines returns the route segments that start in tile (x, y). Routes that continue
+// into a neighbor are drawn once between the two centers, other routes end at the hex edge.
+func routeLines(allTileData *fileio.TileGrid, x int, y int, route fileio.Route) [][2][2]float64 {
+	mask := allTileData.At(x, y).RouteMask(route)
+	if mask == 0 {
+		return nil
+	}
+
+	var lines [][2][2]float64
+	px, py := HexCenter(x, y)
+	for direction := 0; direction < 6; direction++ {
+		if mask&(1<<direction) == 0 {
+			continue
+		}
+		nx, ny := fileio.Neighbor(x, y, direction)
+		if allTileData.Contains(nx, ny) {
+			opposite := fileio.OppositeDirection(direction)
+			if allTileData.At(nx, ny).RouteMask(route)&(1<<opposite) != 0 {
+				// The neighbor connects back, so only draw it from one side
+				if direction < opposite {
+					qx, qy := HexCenter(nx, ny)
+					lines = append(lines, [2][2]float64{{px, py}, {qx, qy}})
+				}
+				continue
+			}
+		}
+		// Direction 0 is north, which is up in the hex plane
+		angle := math.Pi/2 - float64(direction)*math.Pi/3
+		edge := math.Sqrt(3) / 2
+		lines = append(lines, [2][2]float64{{px, py}, {px + edge*math.Cos(angle), py - edge*math.Sin(angle)}})
+	}
+	return lines
+}
+
+// WriteGeoJSON writes the map as a GeoJSON feature collection with one feature per line.
+// Every tile that isn't empty becomes a hexagon, routes become line strings and
+// locations and units on the map become points. The kind property tells them apart.
+func WriteGeoJSON(w io.Writer, mapData *fileio.TOAWMapData, georef *Georeference) error {
+	bw := bufio.NewWriter(w)
+	first := true
+	writeFeature := func(geometryType string, coordinates interface{}, properties map[string]interface{}) error {
+		separator := ",\n"
+		if first {
+			separator = "\n"
+			first = false
+		}
+		if _, err := bw.WriteString(separator); err != nil {
+			return err
+		}
+		feature := geoJsonFeature{
+			Type:       "Feature",
+			Geometry:   geoJsonGeometry{Type: geometryType, Coordinates: coordinates},
+			Properties: properties,
+		}
+		data, err := json.Marshal(feature)
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(data)
+		return err
+	}
+
+	if _, err := bw.WriteString(`{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+
+	allTileData := mapData.AllTileData
+	for x := 0; x < allTileData.Width(); x++ {
+		for y := 0; y < allTileData.Height(); y++ {
+			tileData := allTileData.At(x, y)
+			if tileData.IsEmpty() {
+				continue
+			}
+			properties := map[string]interface{}{
+				"kind":    "hex",
+				"x":       x,
+				"y":       y,
+				"terrain": tileData.Terrain(),
+			}
+			if features := tileData.Features(); len(features) > 0 {
+				properties["features"] = features
+			}
+			if err := writeFeature("Polygon", georef.hexPolygon(x, y), properties); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, route := range fileio.AllRoutes {
+		for x := 0; x < allTileData.Width(); x++ {
+			for y := 0; y < allTileData.Height(); y++ {
+				for _, line := range routeLines(allTileData, x, y, route) {
+					coordinates := [][2]float64{
+						georef.position(line[0][0], line[0][1]),
+						georef.position(line[1][0], line[1][1]),
+					}
+					properties := map[string]interface{}{
+						"kind":  "route",
+						"route": route,
+						"x":     x,
+						"y":     y,
+					}
+					if err := writeFeature("LineString", coordinates, properties); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	for i, locationData := range mapData.AllLocationData {
+		if locationData.IsEmpty() {
+			continue
+		}
+		x, y := int(locationData.X), int(locationData.Y)
+		properties := map[string]interface{}{
+			"kind":  "location",
+			"index": i,
+			"name":  locationData.NameString(mapData.CodePage),
+			"x":     x,
+			"y":     y,
+		}
+		if err := writeFeature("Point", georef.position(HexCenter(x, y)), properties); err != nil {
+			return err
+		}
+	}
+
+	for i, unitData := range mapData.AllUnitData {
+		if !unitData.IsOnMap() {
+			continue
+		}
+		x, y := int(unitData.X), int(unitData.Y)
+		properties := map[string]interface{}{
+			"kind":        "unit",
+			"index":       i,
+			"name":        unitData.NameString(mapData.CodePage),
+			"colorGroup":  unitData.ColorGroup(),
+			"type":        unitData.UnitType(),
+			"proficiency": unitData.Proficiency,
+			"readiness":   unitData.Readiness,
+			"supplyLevel": unitData.SupplyLevel,
+			"x":           x,
+			"y":           y,
+		}
+		if err := writeFeature("Point", georef.position(HexCenter(x, y)), properties); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.WriteString("\n]}\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ExportGeoJSON writes the map to a GeoJSON file.
+func ExportGeoJSON(mapData *fileio.TOAWMapData, georef *Georeference, outputFilename string) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	if err := WriteGeoJSON(outputFile, mapData, georef); err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Package geo places TOAW maps on real geography and exports them to GIS formats.
+
+Positions on the map are measured in the hex plane, where the hex radius is 1,
+hex (0, 0) is at the origin, x grows to the east and y grows to the south.
+This is the same layout the renderer uses, scaled by its hex radius.
+A Georeference maps the hex plane to longitude and latitude.
+*/
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Approximate length of one degree of latitude and of longitude at the equator
+const (
+	kmPerDegreeLatitude  = 110.574
+	kmPerDegreeLongitude = 111.320
+)
+
+var sqrt3 = math.Sqrt(3)
+
+// HexCenter returns the center of hex (x, y) in the hex plane.
+// Odd columns are shifted up by half a hex.
+func HexCenter(x int, y int) (float64, float64) {
+	px := 1.5 * float64(x)
+	py := sqrt3 * float64(y)
+	if x%2 != 0 {
+		py -= sqrt3 / 2
+	}
+	return px, py
+}
+
+// HexCorners returns the six corners of a hex with its center at (px, py),
+// starting with the upper right corner and going clockwise. The hexes have a flat top.
+func HexCorners(px float64, py float64) [6][2]float64 {
+	var corners [6][2]float64
+	for i := range corners {
+		angle := float64(i-1) * math.Pi / 3
+		corners[i] = [2]float64{px + math.Cos(angle), py + math.Sin(angle)}
+	}
+	return corners
+}
+
+// Georeference maps the hex plane to geographic coordinates with an affine transform:
+//
+//	lon = A*px + B*py + C
+//	lat = D*px + E*py + F
+//
+// Over the area covered by a scenario this is close enough to a real projection.
+type Georeference struct {
+	// Transform holds A, B, C, D, E and F
+	Transform [6]float64 `json:"transform"`
+	// HexSizeKm is the distance between the centers of neighboring hexes, if it is known
+	HexSizeKm float64 `json:"hexSizeKm,omitempty"`
+}
+
+// NewGeoreference places the center of hex (0, 0) at the anchor. Neighboring hexes are
+// hexSizeKm apart and the grid is turned clockwise from north by rotationDegrees.
+func NewGeoreference(anchorLat float64, anchorLon float64, hexSizeKm float64, rotationDegrees float64) *Georeference {
+	// The hex radius is the distance from the center to a corner
+	radiusKm := hexSizeKm / sqrt3
+	theta := rotationDegrees * math.Pi / 180
+	kmPerLon := kmPerDegreeLongitude * math.Cos(anchorLat*math.Pi/180)
+	kmPerLat := kmPerDegreeLatitude
+	return &Georeference{
+		Transform: [6]float64{
+			radiusKm * math.Cos(theta) / kmPerLon,
+			-radiusKm * math.Sin(theta) / kmPerLon,
+			anchorLon,
+			-radiusKm * math.Sin(theta) / kmPerLat,
+			-radiusKm * math.Cos(theta) / kmPerLat,
+			anchorLat,
+		},
+		HexSizeKm: hexSizeKm,
+	}
+}
+
+// ToLonLat converts a point in the hex plane to longitude and latitude.
+func (g *Georeference) ToLonLat(px float64, py float64) (float64, float64) {
+	t := g.Transform
+	return t[0]*px + t[1]*py + t[2], t[3]*px + t[4]*py + t[5]
+}
+
+// HexLonLat returns the longitude and latitude of the center of hex (x, y).
+func (g *Georeference) HexLonLat(x int, y int) (float64, float64) {
+	return g.ToLonLat(HexCenter(x, y))
+}
+
+// LoadGeoreference reads a georeference saved with Save.
+func LoadGeoreference(filename string) (*Georeference, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read georeference: %w", err)
+	}
+	georef := &Georeference{}
+	if err := json.Unmarshal(data, georef); err != nil {
+		return nil, fmt.Errorf("failed to parse georeference %s: %w", filename, err)
+	}
+	t := georef.Transform
+	if t[0]*t[4]-t[1]*t[3] == 0 {
+		return nil, fmt.Errorf("georeference %s has a transform that can't be inverted", filename)
+	}
+	return georef, nil
+}
+
+// Save writes the georeference as json so it can be reused for other exports.
+func (g *Georeference) Save(filename string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// PixelTransform combines the georeference with the transform from image pixels to the
+// hex plane, giving the transform from pixels to longitude and latitude.
+// Pixel coordinates are measured from the top left corner of the image.
+func (g *Georeference) PixelTransform(pixelToPlane [6]float64) [6]float64 {
+	t, p := g.Transform, pixelToPlane
+	return [6]float64{
+		t[0]*p[0] + t[1]*p[3],
+		t[0]*p[1] + t[1]*p[4],
+		t[0]*p[2] + t[1]*p[5] + t[2],
+		t[3]*p[0] + t[4]*p[3],
+		t[3]*p[1] + t[4]*p[4],
+		t[3]*p[2] + t[4]*p[5] + t[5],
+	}
+}
@@ -0,0 +1,234 @@
+package geo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// TIFF field types
+const (
+	tiffShort  = 3
+	tiffLong   = 4
+	tiffDouble = 12
+)
+
+// TIFF and GeoTIFF tags
+const (
+	tagImageWidth                = 256
+	tagImageLength               = 257
+	tagBitsPerSample             = 258
+	tagCompression               = 259
+	tagPhotometricInterpretation = 262
+	tagStripOffsets              = 273
+	tagSamplesPerPixel           = 277
+	tagRowsPerStrip              = 278
+	tagStripByteCounts           = 279
+	tagPlanarConfiguration       = 284
+	tagExtraSamples              = 338
+	tagModelTransformation       = 34264
+	tagGeoKeyDirectory           = 34735
+)
+
+// GeoTIFF keys that describe a raster in longitude and latitude on WGS 84
+const (
+	geoKeyModelType         = 1024
+	geoKeyRasterType        = 1025
+	geoKeyGeographicType    = 2048
+	geoKeyGeogAngularUnits  = 2054
+	modelTypeGeographic     = 2
+	rasterPixelIsArea       = 1
+	epsgWGS84               = 4326
+	angularUnitDegree       = 9102
+	compressionAdobeDeflate = 8
+	photometricRGB          = 2
+	extraSampleUnassociated = 2
+	stripSize               = 64 * 1024
+)
+
+type tiffEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	// data holds the values already encoded as little endian
+	data []byte
+}
+
+func shortEntry(tag uint16, values ...uint16) tiffEntry {
+	data := make([]byte, 2*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint16(data[2*i:], value)
+	}
+	return tiffEntry{tag: tag, dataType: tiffShort, count: uint32(len(values)), data: data}
+}
+
+func longEntry(tag uint16, values ...uint32) tiffEntry {
+	data := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], value)
+	}
+	return tiffEntry{tag: tag, dataType: tiffLong, count: uint32(len(values)), data: data}
+}
+
+func doubleEntry(tag uint16, values ...float64) tiffEntry {
+	data := make([]byte, 8*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(value))
+	}
+	return tiffEntry{tag: tag, dataType: tiffDouble, count: uint32(len(values)), data: data}
+}
+
+// compressStrips converts the image to non premultiplied RGBA and compresses it in strips
+func compressStrips(img image.Image, rowsPerStrip int) ([][]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var strips [][]byte
+	row := make([]byte, 4*width)
+	for top := 0; top < height; top += rowsPerStrip {
+		var buffer bytes.Buffer
+		writer := zlib.NewWriter(&buffer)
+		for y := top; y < top+rowsPerStrip && y < height; y++ {
+			for x := 0; x < width; x++ {
+				c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+				row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = c.R, c.G, c.B, c.A
+			}
+			if _, err := writer.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		strips = append(strips, buffer.Bytes())
+	}
+	return strips, nil
+}
+
+// WriteGeoTIFF writes the image as a deflate compressed RGBA GeoTIFF in longitude and latitude
+// on WGS 84. The pixel transform comes from PixelTransform.
+func WriteGeoTIFF(w io.Writer, img image.Image, pixelTransform [6]float64) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rowsPerStrip := stripSize / (4 * width)
+	if rowsPerStrip < 1 {
+		rowsPerStrip = 1
+	}
+	strips, err := compressStrips(img, rowsPerStrip)
+	if err != nil {
+		return err
+	}
+
+	t := pixelTransform
+	entries := []tiffEntry{
+		longEntry(tagImageWidth, uint32(width)),
+		longEntry(tagImageLength, uint32(height)),
+		shortEntry(tagBitsPerSample, 8, 8, 8, 8),
+		shortEntry(tagCompression, compressionAdobeDeflate),
+		shortEntry(tagPhotometricInterpretation, photometricRGB),
+		// The strip offsets are filled in once the layout is known
+		longEntry(tagStripOffsets, make([]uint32, len(strips))...),
+		shortEntry(tagSamplesPerPixel, 4),
+		longEntry(tagRowsPerStrip, uint32(rowsPerStrip)),
+		longEntry(tagStripByteCounts, make([]uint32, len(strips))...),
+		shortEntry(tagPlanarConfiguration, 1),
+		shortEntry(tagExtraSamples, extraSampleUnassociated),
+		doubleEntry(tagModelTransformation,
+			t[0], t[1], 0, t[2],
+			t[3], t[4], 0, t[5],
+			0, 0, 0, 0,
+			0, 0, 0, 1),
+		shortEntry(tagGeoKeyDirectory,
+			1, 1, 0, 4,
+			geoKeyModelType, 0, 1, modelTypeGeographic,
+			geoKeyRasterType, 0, 1, rasterPixelIsArea,
+			geoKeyGeographicType, 0, 1, epsgWGS84,
+			geoKeyGeogAngularUnits, 0, 1, angularUnitDegree),
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	// Layout: header, directory, values that don't fit in an entry, then the strips
+	const headerSize = 8
+	directorySize := 2 + 12*len(entries) + 4
+	offset := uint32(headerSize + directorySize)
+	valueOffsets := make([]uint32, len(entries))
+	for i, entry := range entries {
+		if len(entry.data) > 4 {
+			valueOffsets[i] = offset
+			offset += uint32(len(entry.data))
+			// Values start on a word boundary
+			offset += offset % 2
+		}
+	}
+	for i := range entries {
+		switch entries[i].tag {
+		case tagStripOffsets:
+			stripOffset := offset
+			for s, strip := range strips {
+				binary.LittleEndian.PutUint32(entries[i].data[4*s:], stripOffset)
+				stripOffset += uint32(len(strip))
+			}
+		case tagStripByteCounts:
+			for s, strip := range strips {
+				binary.LittleEndian.PutUint32(entries[i].data[4*s:], uint32(len(strip)))
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("II")
+	binary.Write(&buffer, binary.LittleEndian, uint16(42))
+	binary.Write(&buffer, binary.LittleEndian, uint32(headerSize))
+	binary.Write(&buffer, binary.LittleEndian, uint16(len(entries)))
+	for i, entry := range entries {
+		binary.Write(&buffer, binary.LittleEndian, entry.tag)
+		binary.Write(&buffer, binary.LittleEndian, entry.dataType)
+		binary.Write(&buffer, binary.LittleEndian, entry.count)
+		if len(entry.data) > 4 {
+			binary.Write(&buffer, binary.LittleEndian, valueOffsets[i])
+		} else {
+			value := make([]byte, 4)
+			copy(value, entry.data)
+			buffer.Write(value)
+		}
+	}
+	// There is only one image
+	binary.Write(&buffer, binary.LittleEndian, uint32(0))
+	for _, entry := range entries {
+		if len(entry.data) > 4 {
+			buffer.Write(entry.data)
+			if buffer.Len()%2 != 0 {
+				buffer.WriteByte(0)
+			}
+		}
+	}
+
+	if _, err := w.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+	for _, strip := range strips {
+		if _, err := w.Write(strip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveGeoTIFF writes the image to a GeoTIFF file.
+func SaveGeoTIFF(filename string, img image.Image, pixelTransform [6]float64) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := WriteGeoTIFF(file, img, pixelTransform); err != nil {
+		return err
+	}
+	return file.Close()
+}
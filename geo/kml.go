@@ -0,0 +1,278 @@
+package geo
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+	"github.com/samuelyuan/TOAWMap/palette"
+)
+
+// Units in color groups that have no color in the palette use this style
+const unitStyle = "unit"
+
+type kmlWriter struct {
+	w           *bufio.Writer
+	georef      *Georeference
+	groupColors map[int]palette.GroupColor
+	codePage    fileio.CodePage
+	err         error
+}
+
+func (k *kmlWriter) printf(format string, args ...interface{}) {
+	if k.err == nil {
+		_, k.err = fmt.Fprintf(k.w, format, args...)
+	}
+}
+
+func escapeXml(text string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(text))
+	return builder.String()
+}
+
+// kmlColor converts a color to the aabbggrr hex form used by KML
+func kmlColor(c color.RGBA) string {
+	return fmt.Sprintf("%02x%02x%02x%02x", c.A, c.B, c.G, c.R)
+}
+
+func (k *kmlWriter) coordinates(points [][2]float64) string {
+	parts := make([]string, len(points))
+	for i, point := range points {
+		parts[i] = strconv.FormatFloat(point[0], 'f', -1, 64) + "," + strconv.FormatFloat(point[1], 'f', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (k *kmlWriter) point(x int, y int) string {
+	return k.coordinates([][2]float64{k.georef.position(HexCenter(x, y))})
+}
+
+// colorStyle returns the id of the style for a fill color, like tile-7bb54aff.
+func colorStyle(prefix string, c color.RGBA) string {
+	return fmt.Sprintf("%s-%02x%02x%02x%02x", prefix, c.R, c.G, c.B, c.A)
+}
+
+// groupStyle returns the id of the style for units in the color group.
+func (k *kmlWriter) groupStyle(group int) string {
+	if _, ok := k.groupColors[group]; !ok {
+		return unitStyle
+	}
+	return fmt.Sprintf("group%d", group)
+}
+
+// urbanMarker returns the square drawn on urban tiles, the same size and place
+// as on the rendered map.
+func (k *kmlWriter) urbanMarker(x int, y int) [][2]float64 {
+	px, py := HexCenter(x, y)
+	left, top, right, bottom := px-0.2, py-0.2, px+0.3, py+0.3
+	return [][2]float64{
+		k.georef.position(left, top), k.georef.position(left, bottom),
+		k.georef.position(right, bottom), k.georef.position(right, top),
+		k.georef.position(left, top),
+	}
+}
+
+// writeStyles writes a style for every fill color used by the tiles and urban markers,
+// so the hexes have the same colors as the rendered map.
+func (k *kmlWriter) writeStyles(allTileData *fileio.TileGrid, groups []int) {
+	fills := make(map[string]color.RGBA)
+	allTileData.Each(func(x int, y int, tileData fileio.TileData) {
+		if tileData.IsEmpty() {
+			return
+		}
+		tileColor := palette.TileColor(tileData)
+		fills[colorStyle("tile", tileColor)] = tileColor
+		if tileData.IsUrban() {
+			markerColor := palette.UrbanMarkerColor(tileData)
+			fills[colorStyle("urban", markerColor)] = markerColor
+		}
+	})
+	styles := make([]string, 0, len(fills))
+	for style := range fills {
+		styles = append(styles, style)
+	}
+	sort.Strings(styles)
+	for _, style := range styles {
+		k.printf("<Style id=\"%s\"><LineStyle><width>0</width></LineStyle><PolyStyle><color>%s</color></PolyStyle></Style>\n",
+			style, kmlColor(fills[style]))
+	}
+	for _, route := range fileio.AllRoutes {
+		k.printf("<Style id=\"%s\"><LineStyle><color>%s</color><width>2</width></LineStyle></Style>\n",
+			route, kmlColor(palette.RouteColors[route]))
+	}
+
+	const icon = "<Icon><href>http://maps.google.com/mapfiles/kml/shapes/placemark_square.png</href></Icon>"
+	k.printf("<Style id=\"%s\"><IconStyle>%s</IconStyle></Style>\n", unitStyle, icon)
+	for _, group := range groups {
+		groupColor, ok := k.groupColors[group]
+		if !ok {
+			continue
+		}
+		k.printf("<Style id=\"%s\"><IconStyle><color>%s</color>%s</IconStyle>"+
+			"<LabelStyle><color>%s</color></LabelStyle></Style>\n",
+			k.groupStyle(group), kmlColor(groupColor.OuterColor), icon, kmlColor(groupColor.InnerColor))
+	}
+}
+
+func (k *kmlWriter) writeTerrain(allTileData *fileio.TileGrid) {
+	k.printf("<Folder><name>Terrain</name>\n")
+	for x := 0; x < allTileData.Width(); x++ {
+		for y := 0; y < allTileData.Height(); y++ {
+			tileData := allTileData.At(x, y)
+			if tileData.IsEmpty() {
+				continue
+			}
+			description := "Terrain: " + string(tileData.Terrain())
+			if features := tileData.Features(); len(features) > 0 {
+				names := make([]string, len(features))
+				for i, feature := range features {
+					names[i] = string(feature)
+				}
+				description += "\nFeatures: " + strings.Join(names, ", ")
+			}
+			ring := k.georef.hexPolygon(x, y)[0]
+			k.printf("<Placemark><name>%d,%d</name><description>%s</description><styleUrl>#%s</styleUrl>"+
+				"<Polygon><outerBoundaryIs><LinearRing><coordinates>%s</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>\n",
+				x, y, escapeXml(description), colorStyle("tile", palette.TileColor(tileData)), k.coordinates(ring))
+		}
+	}
+
+	k.printf("<Folder><name>Urban</name>\n")
+	for x := 0; x < allTileData.Width(); x++ {
+		for y := 0; y < allTileData.Height(); y++ {
+			tileData := allTileData.At(x, y)
+			if !tileData.IsUrban() {
+				continue
+			}
+			k.printf("<Placemark><name>%d,%d</name><styleUrl>#%s</styleUrl>"+
+				"<Polygon><outerBoundaryIs><LinearRing><coordinates>%s</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>\n",
+				x, y, colorStyle("urban", palette.UrbanMarkerColor(tileData)), k.coordinates(k.urbanMarker(x, y)))
+		}
+	}
+	k.printf("</Folder>\n</Folder>\n")
+}
+
+func (k *kmlWriter) writeRoutes(allTileData *fileio.TileGrid) {
+	k.printf("<Folder><name>Routes</name>\n")
+	for _, route := range fileio.AllRoutes {
+		k.printf("<Folder><name>%s</name>\n", route)
+		for x := 0; x < allTileData.Width(); x++ {
+			for y := 0; y < allTileData.Height(); y++ {
+				for _, line := range routeLines(allTileData, x, y, route) {
+					coordinates := [][2]float64{
+						k.georef.position(line[0][0], line[0][1]),
+						k.georef.position(line[1][0], line[1][1]),
+					}
+					k.printf("<Placemark><styleUrl>#%s</styleUrl><LineString><coordinates>%s</coordinates></LineString></Placemark>\n",
+						route, k.coordinates(coordinates))
+				}
+			}
+		}
+		k.printf("</Folder>\n")
+	}
+	k.printf("</Folder>\n")
+}
+
+func (k *kmlWriter) writeLocations(allLocationData []fileio.LocationData) {
+	k.printf("<Folder><name>Locations</name>\n")
+	for _, locationData := range allLocationData {
+		if locationData.IsEmpty() {
+			continue
+		}
+		k.printf("<Placemark><name>%s</name><Point><coordinates>%s</coordinates></Point></Placemark>\n",
+			escapeXml(locationData.NameString(k.codePage)), k.point(int(locationData.X), int(locationData.Y)))
+	}
+	k.printf("</Folder>\n")
+}
+
+// writeUnits writes a folder of units for each color group. The scenario doesn't store
+// which side a color group belongs to, so the sides are listed in the description of
+// the units folder instead of naming the groups after them.
+func (k *kmlWriter) writeUnits(allUnitData []*fileio.UnitData, allTeamNameData []*fileio.TeamNameData, groups []int) {
+	var sides []string
+	for _, team := range allTeamNameData {
+		if name := team.SideName(k.codePage); name != "" {
+			sides = append(sides, name)
+		}
+	}
+	description := "Units by color group. The scenario doesn't store which side a color group belongs to."
+	if len(sides) > 0 {
+		description = "Sides: " + strings.Join(sides, ", ") + "\n" + description
+	}
+	k.printf("<Folder><name>Units</name><description>%s</description>\n", escapeXml(description))
+	for _, group := range groups {
+		k.printf("<Folder><name>Color group %d</name>\n", group)
+		for i, unitData := range allUnitData {
+			if !unitData.IsOnMap() || unitData.ColorGroup() != group {
+				continue
+			}
+			description := fmt.Sprintf("Unit %d\nType: %d\nProficiency: %d\nReadiness: %d\nSupply: %d",
+				i, unitData.UnitType(), unitData.Proficiency, unitData.Readiness, unitData.SupplyLevel)
+			k.printf("<Placemark><name>%s</name><description>%s</description><styleUrl>#%s</styleUrl>"+
+				"<Point><coordinates>%s</coordinates></Point></Placemark>\n",
+				escapeXml(unitData.NameString(k.codePage)), escapeXml(description), k.groupStyle(group), k.point(int(unitData.X), int(unitData.Y)))
+		}
+		k.printf("</Folder>\n")
+	}
+	k.printf("</Folder>\n")
+}
+
+// WriteKML writes the map as a KML document with folders for terrain, routes, locations
+// and units. Terrain, urban markers, routes and units use the same colors as the
+// rendered map and units are grouped by their color group.
+func WriteKML(w io.Writer, mapData *fileio.TOAWMapData, georef *Georeference, name string) error {
+	k := &kmlWriter{w: bufio.NewWriter(w), georef: georef, groupColors: palette.GroupColors(), codePage: mapData.CodePage}
+
+	groupSet := make(map[int]bool)
+	for _, unitData := range mapData.AllUnitData {
+		if unitData.IsOnMap() {
+			groupSet[unitData.ColorGroup()] = true
+		}
+	}
+	groups := make([]int, 0, len(groupSet))
+	for group := range groupSet {
+		groups = append(groups, group)
+	}
+	sort.Ints(groups)
+
+	k.printf("%s<kml xmlns=\"http://www.opengis.net/kml/2.2\">\n<Document>\n<name>%s</name>\n", xml.Header, escapeXml(name))
+	k.writeStyles(mapData.AllTileData, groups)
+	k.writeTerrain(mapData.AllTileData)
+	k.writeRoutes(mapData.AllTileData)
+	k.writeLocations(mapData.AllLocationData)
+	k.writeUnits(mapData.AllUnitData, mapData.AllTeamNameData, groups)
+	k.printf("</Document>\n</kml>\n")
+	if k.err != nil {
+		return k.err
+	}
+	return k.w.Flush()
+}
+
+// ExportKML writes the map to a KML file. The document is named after the map title,
+// or the file name if the title isn't known.
+func ExportKML(mapData *fileio.TOAWMapData, georef *Georeference, outputFilename string) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	name := outputFilename
+	if mapData.Header != nil {
+		if title := mapData.Header.TitleString(mapData.CodePage); title != "" {
+			name = title
+		}
+	}
+	if err := WriteKML(outputFile, mapData, georef, name); err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
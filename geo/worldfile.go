@@ -0,0 +1,30 @@
+package geo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WorldFilename returns the name of the world file for an image, which uses the first and
+// last letter of the image extension followed by w, like map.pgw for map.png.
+func WorldFilename(imageFilename string) string {
+	extension := filepath.Ext(imageFilename)
+	base := strings.TrimSuffix(imageFilename, extension)
+	extension = strings.TrimPrefix(extension, ".")
+	if len(extension) < 2 {
+		return base + ".wld"
+	}
+	return base + "." + extension[:1] + extension[len(extension)-1:] + "w"
+}
+
+// WriteWorldFile writes the six lines of a world file for a pixel transform from PixelTransform.
+// World files give the position of the center of the top left pixel instead of its corner.
+func WriteWorldFile(filename string, pixelTransform [6]float64) error {
+	t := pixelTransform
+	centerX := t[0]*0.5 + t[1]*0.5 + t[2]
+	centerY := t[3]*0.5 + t[4]*0.5 + t[5]
+	contents := fmt.Sprintf("%.12f\n%.12f\n%.12f\n%.12f\n%.12f\n%.12f\n", t[0], t[3], t[1], t[4], centerX, centerY)
+	return os.WriteFile(filename, []byte(contents), 0644)
+}
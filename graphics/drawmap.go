@@ -3,21 +3,29 @@ package graphics
 import (
 	"fmt"
 	"image/color"
+	"io"
+	"log"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/fogleman/gg"
 	"github.com/samuelyuan/TOAWMap/fileio"
+	"github.com/samuelyuan/TOAWMap/geo"
+	"github.com/samuelyuan/TOAWMap/palette"
 )
 
 const (
-	radius = 10.0
+	// defaultRadius is the hex radius in pixels when the options don't set a size
+	defaultRadius = 10.0
+	// labelFontSize is the size of the location names at the default radius
+	labelFontSize = 11.0
 )
 
-func getImagePosition(i int, j int) (float64, float64) {
+func getImagePosition(i int, j int, radius float64) (float64, float64) {
 	angle := math.Pi / 6
 	x := radius + float64(j)*radius*(1+math.Sin(angle))
 	y := (radius * 1.5) + float64(i)*(2*radius*math.Cos(angle))
@@ -27,6 +35,12 @@ func getImagePosition(i int, j int) (float64, float64) {
 	return x, y
 }
 
+// pixelToPlane converts image pixels to the hex plane used by the geo package,
+// which has a hex radius of 1 and the center of hex (0, 0) at the origin.
+func pixelToPlane(radius float64) [6]float64 {
+	return [6]float64{1 / radius, 0, -1, 0, 1 / radius, -1.5}
+}
+
 func IsTileEmpty(tileData *fileio.TileData) bool {
 	return tileData.Data[38]&0x10 != 0
 }
@@ -93,147 +107,117 @@ func DoesTileHaveRoad(tileData *fileio.TileData) bool {
 	return tileData.Data[38]&0x10 == 0 && tileData.Data[31] != 0
 }
 
-func drawTiles(dc *gg.Context, allTileData [][]*fileio.TileData, mapHeight int, mapWidth int) {
+func drawTiles(r Renderer, allTileData *fileio.TileGrid, mapHeight int, mapWidth int, radius float64) {
+	r.BeginLayer("terrain")
 	for i := 0; i < mapHeight; i++ {
 		for j := 0; j < mapWidth; j++ {
-			x, y := getImagePosition(i, j)
-			dc.DrawRegularPolygon(6, x, y, radius, 0)
-
-			tileData := allTileData[i][j]
-
-			if IsTileEmpty(tileData) {
-				dc.SetRGB255(0, 0, 0)
-			} else if IsTileImpassable(tileData) {
-				dc.SetRGB255(67, 65, 68)
-			} else if IsTileDeepWater(tileData) {
-				dc.SetRGB255(21, 43, 116)
-			} else if IsTileShallowWater(tileData) {
-				dc.SetRGB255(64, 93, 166)
-			} else if IsTileForest(tileData) {
-				dc.SetRGB255(78, 116, 53)
-			} else if IsTileMountains(tileData) {
-				dc.SetRGB255(169, 154, 133)
-			} else if IsTileHills(tileData) {
-				dc.SetRGB255(149, 132, 58)
-			} else if IsTileSand(tileData) {
-				dc.SetRGB255(189, 159, 86)
-			} else if IsTileFloodedMarsh(tileData) {
-				dc.SetRGB255(137, 172, 139)
-			} else if IsTileMarsh(tileData) {
-				dc.SetRGB255(122, 148, 71)
-			} else {
-				// Grass tile as default
-				dc.SetRGB255(146, 155, 59)
+			x, y := getImagePosition(i, j, radius)
+			tile := allTileData.At(j, i)
+			tileData := &tile
+
+			class := svgClass("terrain", string(tile.Terrain()))
+			if palette.ShowsForest(tile) {
+				class += " forest"
 			}
-			dc.Fill()
+			if feature, ok := palette.TileFeature(tile); ok {
+				class += " " + svgClass("feature", string(feature))
+			}
+			r.Polygon(hexCorners(x, y, radius), Style{Class: class, Fill: palette.TileColor(tile)})
 
 			if IsTileUrban(tileData) {
-				dc.DrawRectangle(x-(radius/5), y-(radius/5), radius/2, radius/2)
-				dc.SetRGB255(255, 255, 255)
-				dc.Fill()
+				urbanClass := "urban"
+				if feature, ok := palette.UrbanFeature(tile); ok {
+					urbanClass += " " + svgClass("feature", string(feature))
+				}
+				r.Rectangle(x-(radius/5), y-(radius/5), radius/2, radius/2, Style{Class: urbanClass, Fill: palette.UrbanMarkerColor(tile)})
 			}
 		}
 	}
+	r.EndLayer()
 }
 
-func drawTileRoutes(dc *gg.Context, routeData byte, x float64, y float64) {
+func drawTileRoutes(r Renderer, routeData byte, x float64, y float64, radius float64, style Style) {
 	// Bit mapping: 1=North, 2=Northeast, 4=Southeast, 8=South, 16=Southwest, 32=Northwest
 	for n := 0; n < 6; n++ {
 		if ((routeData >> n) & 1) != 0 {
-			drawRoute(dc, x, y, n)
+			drawRoute(r, x, y, radius, n, style)
 		}
 	}
 }
 
-func drawRoute(dc *gg.Context, x float64, y float64, directionIndex int) {
+func drawRoute(r Renderer, x float64, y float64, radius float64, directionIndex int, style Style) {
 	angle := (math.Pi / 2) - float64(directionIndex)*(math.Pi/3)
 	edgeX := x + radius*math.Cos(angle)
 	edgeY := y - radius*math.Sin(angle)
-	dc.DrawLine(x, y, edgeX, edgeY)
-	dc.Stroke()
+	r.Line(x, y, edgeX, edgeY, style)
 }
 
-func drawRiversAndRoads(dc *gg.Context, allTileData [][]*fileio.TileData, mapHeight int, mapWidth int) {
-	for i := 0; i < mapHeight; i++ {
-		for j := 0; j < mapWidth; j++ {
-			tileData := allTileData[i][j]
-
-			// The body of water covers the river
-			if IsTileDeepWater(tileData) || IsTileShallowWater(tileData) {
-				continue
-			}
+// drawnRoutes lists the routes on the rendered map in the order they are drawn.
+// Dry rivers are left out.
+var drawnRoutes = []fileio.Route{fileio.RouteRiver, fileio.RouteMajorRiver, fileio.RouteRoad, fileio.RouteRailroad}
 
-			x, y := getImagePosition(i, j)
-
-			if DoesTileHaveRiver(tileData) {
-				dc.SetRGB255(91, 130, 150)
-				routeData := tileData.Data[22]
-				drawTileRoutes(dc, routeData, x, y)
-			}
-			if DoesTileHaveMajorRiver(tileData) {
-				dc.SetRGB255(57, 82, 148)
-				routeData := tileData.Data[23]
-				drawTileRoutes(dc, routeData, x, y)
-			}
-			if DoesTileHaveRoad(tileData) {
-				dc.SetRGB255(195, 167, 87)
-				routeData := tileData.Data[31]
-				drawTileRoutes(dc, routeData, x, y)
-			}
-			if DoesTileHaveRailroad(tileData) {
-				dc.SetRGB255(102, 91, 72)
-				routeData := tileData.Data[33]
-				drawTileRoutes(dc, routeData, x, y)
+func drawRiversAndRoads(r Renderer, allTileData *fileio.TileGrid, mapHeight int, mapWidth int, radius float64, layers LayerSet) {
+	r.BeginLayer("routes")
+	for _, route := range drawnRoutes {
+		if !layers.Has(routeLayers[route]) {
+			continue
+		}
+		r.BeginLayer(string(route))
+		style := Style{Class: svgClass("route", string(route)), Stroke: palette.RouteColors[route], LineWidth: radius / defaultRadius}
+		for i := 0; i < mapHeight; i++ {
+			for j := 0; j < mapWidth; j++ {
+				tile := allTileData.At(j, i)
+				tileData := &tile
+
+				// The body of water covers the river
+				if IsTileDeepWater(tileData) || IsTileShallowWater(tileData) {
+					continue
+				}
+
+				if routeData := tile.RouteMask(route); routeData != 0 {
+					x, y := getImagePosition(i, j, radius)
+					drawTileRoutes(r, routeData, x, y, radius, style)
+				}
 			}
 		}
+		r.EndLayer()
 	}
+	r.EndLayer()
 }
 
-func drawUnits(dc *gg.Context, mapData *fileio.TOAWMapData) {
+// unitGroupColors returns the colors of the color groups. Groups with units on the map
+// that have no predefined color get a random one.
+func unitGroupColors(mapData *fileio.TOAWMapData) map[int]GroupColor {
 	rand.Seed(time.Now().UnixNano())
 
 	groupColorMap := initGroupColorMap()
-	unitTeamMap := make(map[int][]string)
-
-	for i := 0; i < len(mapData.AllUnitData); i++ {
-		unitData := mapData.AllUnitData[i]
-		x := int(unitData.X)
-		y := int(unitData.Y)
-		if x == 999 || y == 999 {
+	for _, unitData := range mapData.AllUnitData {
+		if !unitData.IsOnMap() {
 			continue
 		}
-		imageX, imageY := getImagePosition(y, x)
-
-		team := int((unitData.UnitColorAndType + ((unitData.UnitColorAndType >> 31) & 0x7f)) >> 7)
-		unitType := int(unitData.UnitColorAndType & 0x8000007f)
-
-		if _, ok := groupColorMap[int(team)]; !ok {
+		team := unitData.ColorGroup()
+		if _, ok := groupColorMap[team]; !ok {
 			fmt.Println("Generating random color for group", team)
-			groupColorMap[int(team)] = GroupColor{
+			groupColorMap[team] = GroupColor{
 				OuterColor: color.RGBA{uint8(rand.Intn(255)), uint8(rand.Intn(255)), uint8(rand.Intn(255)), 255},
 				InnerColor: color.RGBA{uint8(rand.Intn(255)), uint8(rand.Intn(255)), uint8(rand.Intn(255)), 255},
 			}
 		}
-		if _, ok := unitTeamMap[int(team)]; !ok {
-			unitTeamMap[int(team)] = make([]string, 0)
+	}
+	return groupColorMap
+}
+
+// printUnitGroups lists the units on the map by color group.
+func printUnitGroups(mapData *fileio.TOAWMapData, groupColorMap map[int]GroupColor) {
+	unitTeamMap := make(map[int][]string)
+	for _, unitData := range mapData.AllUnitData {
+		if !unitData.IsOnMap() {
+			continue
 		}
-		teamName := string(strings.Split(string(unitData.Name[:]), "\x00")[0])
-		unitTeamMap[int(team)] = append(unitTeamMap[int(team)], fmt.Sprintf("%v (type: %v)", teamName, unitType))
-
-		outerColor := groupColorMap[int(team)].OuterColor
-		dc.DrawRectangle(imageX-(radius*2/3), imageY-(radius*2/3), radius*4/3, radius*4/3)
-		dc.SetRGB255(int(outerColor.R), int(outerColor.G), int(outerColor.B))
-		dc.Fill()
-
-		innerColor := groupColorMap[int(team)].InnerColor
-		dc.DrawRectangle(imageX-(radius*1/3), imageY-(radius*1/3), radius*2/3, radius*2/3)
-		dc.SetRGB255(int(innerColor.R), int(innerColor.G), int(innerColor.B))
-		dc.Fill()
-
-		// dc.SetRGB255(255, 255, 255)
-		// name := string(strings.Split(string(unitData.Name[:]), "\x00")[0])
-		// dc.DrawString(name, imageX-(5.0*float64(len(name))/2.0), imageY-(radius*1.5))
+		team := unitData.ColorGroup()
+		unitTeamMap[team] = append(unitTeamMap[team], fmt.Sprintf("%v (type: %v)", unitData.NameString(mapData.CodePage), unitData.UnitType()))
 	}
+
 	fmt.Println("Team data:")
 	keys := make([]int, 0, len(unitTeamMap))
 	for k := range unitTeamMap {
@@ -250,34 +234,242 @@ func drawUnits(dc *gg.Context, mapData *fileio.TOAWMapData) {
 	}
 }
 
-func drawLocations(dc *gg.Context, mapData *fileio.TOAWMapData) {
+func drawUnits(r Renderer, mapData *fileio.TOAWMapData, groupColorMap map[int]GroupColor, radius float64) {
+	r.BeginLayer("units")
+	for i := 0; i < len(mapData.AllUnitData); i++ {
+		unitData := mapData.AllUnitData[i]
+		if !unitData.IsOnMap() {
+			continue
+		}
+		imageX, imageY := getImagePosition(int(unitData.Y), int(unitData.X), radius)
+
+		team := unitData.ColorGroup()
+		title := strings.TrimSpace(unitData.NameString(mapData.CodePage))
+		group := fmt.Sprintf("group-%d", team)
+		r.Rectangle(imageX-(radius*2/3), imageY-(radius*2/3), radius*4/3, radius*4/3,
+			Style{Class: "unit-outer " + group, Fill: groupColorMap[team].OuterColor, Title: title})
+		r.Rectangle(imageX-(radius*1/3), imageY-(radius*1/3), radius*2/3, radius*2/3,
+			Style{Class: "unit-inner " + group, Fill: groupColorMap[team].InnerColor, Title: title})
+	}
+	r.EndLayer()
+}
+
+func drawLocations(r Renderer, mapData *fileio.TOAWMapData, radius float64) {
+	r.BeginLayer("labels")
 	for i := 0; i < len(mapData.AllLocationData); i++ {
 		location := mapData.AllLocationData[i]
-		x := int(location.X)
-		y := int(location.Y)
-		locationName := string(strings.Split(string(location.Name[:]), "\x00")[0])
-		if x == 999 {
-			// Empty location data
+		if location.IsEmpty() {
 			continue
 		}
 
-		dc.SetRGB255(255, 255, 255)
+		imageX, imageY := getImagePosition(int(location.Y), int(location.X), radius)
+		r.Text(location.NameString(mapData.CodePage), imageX, imageY-(radius*1.25),
+			Style{Class: "label", Fill: palette.LocationColor, FontSize: labelFontSize * radius / defaultRadius})
+	}
+	r.EndLayer()
+}
 
-		imageX, imageY := getImagePosition(y, x)
-		dc.DrawString(locationName, imageX-(5.0*float64(len(locationName))/2.0), imageY-(radius*1.25))
+// drawMap draws the layers of the map in the set with hexes of the given radius.
+func drawMap(r Renderer, mapData *fileio.TOAWMapData, groupColorMap map[int]GroupColor, radius float64, layers LayerSet) {
+	// The tiles are drawn with the size of the grid, which is empty for a json file without tiles
+	allTileData := mapData.AllTileData
+	if layers.Has(LayerTerrain) {
+		drawTiles(r, allTileData, allTileData.Height(), allTileData.Width(), radius)
+	}
+	drawRiversAndRoads(r, allTileData, allTileData.Height(), allTileData.Width(), radius, layers)
+	if layers.Has(LayerUnits) {
+		drawUnits(r, mapData, groupColorMap, radius)
+	}
+	if layers.Has(LayerLabels) {
+		drawLocations(r, mapData, radius)
 	}
 }
 
+// imageRadius returns the hex radius for the options. A target width or height takes
+// the largest radius that fits, otherwise the radius of the options or the default is used.
+func imageRadius(mapData *fileio.TOAWMapData, options DrawOptions) (float64, error) {
+	if options.Width < 0 || options.Height < 0 || options.Radius < 0 {
+		return 0, fmt.Errorf("the image size and hex radius can't be negative")
+	}
+	if options.Width == 0 && options.Height == 0 {
+		if options.Radius == 0 {
+			return defaultRadius, nil
+		}
+		return options.Radius, nil
+	}
+
+	// The image size is proportional to the radius
+	unitWidth, unitHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, 1)
+	radius := math.Inf(1)
+	if options.Width > 0 {
+		radius = float64(options.Width) / unitWidth
+	}
+	if options.Height > 0 {
+		radius = math.Min(radius, float64(options.Height)/unitHeight)
+	}
+	return radius, nil
+}
+
+// DrawOptions are optional settings for DrawMapWithOptions.
+type DrawOptions struct {
+	// Georeference places the image on real geography. When it is set a world file
+	// is written next to the image.
+	Georeference *geo.Georeference
+	// GeoTIFF also saves the image as a GeoTIFF with the same name and a .tif extension.
+	// It needs a Georeference.
+	GeoTIFF bool
+	// Print splits a PDF across pages of paper, with a cover page. Without it the PDF
+	// has one page that fits the map.
+	Print *PrintOptions
+	// Radius is the distance from the center to a corner of a hex in pixels,
+	// 10 if it isn't set. Labels, units and routes are scaled with it.
+	Radius float64
+	// Width and Height are the largest size of the image in pixels. When either is set
+	// the radius is chosen so the map fits, and Radius is ignored.
+	Width  int
+	Height int
+	// Layers are the parts of the map that are drawn, every layer if it is nil.
+	// Hexes are left transparent without the terrain layer.
+	Layers LayerSet
+	// Legend adds a margin below the map with the title, the sides, a legend and a
+	// scale bar. A printed PDF has the legend on its cover page instead.
+	Legend bool
+	// HexSizeKm is the distance between neighboring hex centers, which is shown on the
+	// scale bar. The size of the Georeference is used if it isn't set.
+	HexSizeKm float64
+}
+
 func DrawMap(mapData *fileio.TOAWMapData, outputFilename string) {
-	maxImageWidth, maxImageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth)
-	dc := gg.NewContext(int(maxImageWidth), int(maxImageHeight))
+	DrawMapWithOptions(mapData, outputFilename, DrawOptions{})
+}
+
+// saveDocument writes a vector image to a file.
+func saveDocument(outputFilename string, document io.WriterTo) {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	if _, err := document.WriteTo(outputFile); err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
+
+// DrawMapWithOptions draws the map to a PNG file, or an SVG or PDF file if the file name
+// ends in .svg or .pdf.
+func DrawMapWithOptions(mapData *fileio.TOAWMapData, outputFilename string, options DrawOptions) {
+	radius, err := imageRadius(mapData, options)
+	if err != nil {
+		log.Fatal("Invalid image size: ", err)
+	}
+	extension := strings.ToLower(filepath.Ext(outputFilename))
+	if (extension == ".svg" || extension == ".pdf") && options.Georeference != nil {
+		log.Fatal("The world file and GeoTIFF can only be written for PNG output")
+	}
+	if options.Print != nil && extension != ".pdf" {
+		log.Fatal("Printing on pages needs PDF output")
+	}
 	fmt.Printf("Rendering map: %dx%d tiles\n", mapData.MapWidth, mapData.MapHeight)
+	groupColorMap := unitGroupColors(mapData)
+	defer printUnitGroups(mapData, groupColorMap)
+
+	var margin *mapMargin
+	if options.Legend && options.Print == nil {
+		hexSizeKm := options.HexSizeKm
+		if hexSizeKm == 0 && options.Georeference != nil {
+			hexSizeKm = options.Georeference.HexSizeKm
+		}
+		title := mapTitle(mapData, outputFilename)
+		m := newMapMargin(mapData, title, groupColorMap, options.Layers, radius, hexSizeKm)
+		if options.Height > 0 {
+			// The margin is part of the target height, so the map and the margin are
+			// scaled together, with the margin at its default size at the default radius.
+			_, unitHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, 1)
+			_, marginHeight := newMapMargin(mapData, title, groupColorMap, options.Layers, defaultRadius, hexSizeKm).size()
+			radius = math.Min(radius, float64(options.Height)/(unitHeight+marginHeight/defaultRadius))
+			m = newMapMargin(mapData, title, groupColorMap, options.Layers, radius, hexSizeKm)
+			if radius < defaultRadius {
+				m.scale *= radius / defaultRadius
+			}
+		}
+		if options.Width > 0 {
+			m.fitWidth(float64(options.Width))
+		}
+		margin = &m
+	}
+
+	maxImageWidth, maxImageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, radius)
+	width, height := int(maxImageWidth), int(maxImageHeight)
+	if width == 0 || height == 0 {
+		log.Fatal("The image is too small to draw the map")
+	}
+	// The margin is added below the map, which keeps its place in the image
+	mapHeight := height
+	if margin != nil {
+		marginWidth, marginHeight := margin.size()
+		width = max(width, int(math.Ceil(marginWidth)))
+		height += int(math.Ceil(marginHeight))
+	}
+	// drawImage draws the map and the margin if there is one
+	drawImage := func(r Renderer) {
+		drawMap(r, mapData, groupColorMap, radius, options.Layers)
+		if margin != nil {
+			margin.draw(r, float64(mapHeight), float64(width), radius)
+		}
+	}
 
-	drawTiles(dc, mapData.AllTileData, int(mapData.MapHeight), int(mapData.MapWidth))
-	drawRiversAndRoads(dc, mapData.AllTileData, int(mapData.MapHeight), int(mapData.MapWidth))
-	drawUnits(dc, mapData)
-	drawLocations(dc, mapData)
+	if options.Print == nil {
+		fmt.Printf("Image size: %dx%d pixels, hex radius %.2f\n", width, height, radius)
+	}
+
+	switch extension {
+	case ".svg":
+		renderer := newSVGRenderer(width, height)
+		drawImage(renderer)
+		saveDocument(outputFilename, renderer)
+		fmt.Println("Saved image to", outputFilename)
+		return
+	case ".pdf":
+		var document *pdfDocument
+		if options.Print != nil {
+			if document, err = printDocument(mapData, mapTitle(mapData, outputFilename), groupColorMap, *options.Print, options.Layers); err != nil {
+				log.Fatal("Failed to print the map: ", err)
+			}
+		} else {
+			// One pixel is one point on a page that fits the map
+			renderer := newPDFRenderer(float64(height), 1, 0, 0)
+			drawImage(renderer)
+			document = &pdfDocument{}
+			document.AddPage(float64(width), float64(height), renderer.Bytes())
+		}
+		saveDocument(outputFilename, document)
+		fmt.Println("Saved image to", outputFilename)
+		return
+	}
+
+	renderer := newRasterRenderer(width, height)
+	drawImage(renderer)
+	dc := renderer.dc
 
 	dc.SavePNG(outputFilename)
 	fmt.Println("Saved image to", outputFilename)
+
+	if options.Georeference == nil {
+		return
+	}
+	pixelTransform := options.Georeference.PixelTransform(pixelToPlane(radius))
+	worldFilename := geo.WorldFilename(outputFilename)
+	if err := geo.WriteWorldFile(worldFilename, pixelTransform); err != nil {
+		log.Fatal("Failed to write world file: ", err)
+	}
+	fmt.Println("Saved world file to", worldFilename)
+
+	if options.GeoTIFF {
+		tiffFilename := strings.TrimSuffix(outputFilename, filepath.Ext(outputFilename)) + ".tif"
+		if err := geo.SaveGeoTIFF(tiffFilename, dc.Image(), pixelTransform); err != nil {
+			log.Fatal("Failed to write GeoTIFF: ", err)
+		}
+		fmt.Println("Saved GeoTIFF to", tiffFilename)
+	}
 }
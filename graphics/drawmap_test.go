@@ -0,0 +1,54 @@
+package graphics
+
+import (
+	"io"
+	"testing"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// syntheticMapData returns a 700x700 map, the largest TOAW4 allows, with bands of every
+// terrain and a road and river crossing every row.
+func syntheticMapData() *fileio.TOAWMapData {
+	const size = 700
+	grid := fileio.NewTileGrid(size, size, 48)
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			tileData := grid.At(x, y)
+			tileData.SetTerrain(fileio.AllTerrains[(x/7+y/5)%len(fileio.AllTerrains)])
+			if x%10 == 0 {
+				tileData.SetRouteMask(fileio.RouteRoad, 1<<fileio.DirectionNorth|1<<fileio.DirectionSouth)
+			}
+			if y%12 == 0 {
+				tileData.SetRouteMask(fileio.RouteRiver, 1<<fileio.DirectionNortheast|1<<fileio.DirectionSouthwest)
+			}
+		}
+	}
+	return &fileio.TOAWMapData{Version: 4, AllTileData: grid, MapWidth: size, MapHeight: size}
+}
+
+// BenchmarkDrawMap renders the map with a small radius, since the default radius
+// would need an image of more than 10000x12000 pixels.
+func BenchmarkDrawMap(b *testing.B) {
+	mapData := syntheticMapData()
+	const radius = 2.0
+	imageWidth, imageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, radius)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := newRasterRenderer(int(imageWidth), int(imageHeight))
+		drawMap(r, mapData, nil, radius, nil)
+	}
+}
+
+func BenchmarkDrawMapSVG(b *testing.B) {
+	mapData := syntheticMapData()
+	imageWidth, imageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, defaultRadius)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := newSVGRenderer(int(imageWidth), int(imageHeight))
+		drawMap(r, mapData, nil, defaultRadius, nil)
+		if _, err := r.WriteTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
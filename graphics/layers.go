@@ -0,0 +1,88 @@
+package graphics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// Layer is a part of the map that can be drawn or left out.
+type Layer string
+
+const (
+	LayerTerrain   Layer = "terrain"
+	LayerRivers    Layer = "rivers"
+	LayerRoads     Layer = "roads"
+	LayerRailroads Layer = "rails"
+	LayerUnits     Layer = "units"
+	LayerLabels    Layer = "labels"
+)
+
+// AllLayers lists every layer in the order they are drawn.
+var AllLayers = []Layer{LayerTerrain, LayerRivers, LayerRoads, LayerRailroads, LayerUnits, LayerLabels}
+
+// routeLayers has the layer each drawn route belongs to.
+var routeLayers = map[fileio.Route]Layer{
+	fileio.RouteRiver:      LayerRivers,
+	fileio.RouteMajorRiver: LayerRivers,
+	fileio.RouteRoad:       LayerRoads,
+	fileio.RouteRailroad:   LayerRailroads,
+}
+
+// LayerSet has the layers that are drawn. A nil set draws every layer.
+type LayerSet map[Layer]bool
+
+// Has reports whether the layer is drawn.
+func (s LayerSet) Has(layer Layer) bool {
+	return s == nil || s[layer]
+}
+
+// ParseLayers reads a comma separated list of layers. Layers starting with "-" are
+// left out, and a list of only those starts from every layer, so "-units" draws
+// everything but the units.
+func ParseLayers(list string) (LayerSet, error) {
+	var included, excluded []Layer
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		exclude := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		var layers []Layer
+		if name == "all" {
+			layers = AllLayers
+		} else if layer := Layer(name); isLayer(layer) {
+			layers = []Layer{layer}
+		} else {
+			return nil, fmt.Errorf("unknown layer %s, expected all or one of %v", name, AllLayers)
+		}
+		if exclude {
+			excluded = append(excluded, layers...)
+		} else {
+			included = append(included, layers...)
+		}
+	}
+	if len(included) == 0 {
+		included = AllLayers
+	}
+
+	set := make(LayerSet)
+	for _, layer := range included {
+		set[layer] = true
+	}
+	for _, layer := range excluded {
+		delete(set, layer)
+	}
+	return set, nil
+}
+
+func isLayer(layer Layer) bool {
+	for _, l := range AllLayers {
+		if l == layer {
+			return true
+		}
+	}
+	return false
+}
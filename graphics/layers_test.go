@@ -0,0 +1,129 @@
+package graphics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+func TestParseLayers(t *testing.T) {
+	for _, test := range []struct {
+		list     string
+		expected []Layer
+	}{
+		{"", AllLayers},
+		{"all", AllLayers},
+		{"terrain,units", []Layer{LayerTerrain, LayerUnits}},
+		{" Roads , RIVERS,", []Layer{LayerRivers, LayerRoads}},
+		{"-units", []Layer{LayerTerrain, LayerRivers, LayerRoads, LayerRailroads, LayerLabels}},
+		{"all,-labels,-rails", []Layer{LayerTerrain, LayerRivers, LayerRoads, LayerUnits}},
+		{"terrain,-terrain", []Layer{}},
+	} {
+		set, err := ParseLayers(test.list)
+		if err != nil {
+			t.Errorf("%q: %v", test.list, err)
+			continue
+		}
+		layers := []Layer{}
+		for _, layer := range AllLayers {
+			if set.Has(layer) {
+				layers = append(layers, layer)
+			}
+		}
+		if !reflect.DeepEqual(layers, test.expected) {
+			t.Errorf("%q draws %v, expected %v", test.list, layers, test.expected)
+		}
+	}
+
+	for _, list := range []string{"forest", "terrain,railroad", "-cities"} {
+		if _, err := ParseLayers(list); err == nil || !strings.Contains(err.Error(), "unknown layer") {
+			t.Errorf("%q: error is %v, expected an unknown layer", list, err)
+		}
+	}
+	if !LayerSet(nil).Has(LayerUnits) {
+		t.Error("a nil set should draw every layer")
+	}
+}
+
+// layerMapData returns a land map with every drawn route, a unit and a location.
+func layerMapData() *fileio.TOAWMapData {
+	mapData := smallMapData(6, 4)
+	mapData.AllTileData.Each(func(x int, y int, tileData fileio.TileData) {
+		tileData.SetTerrain(fileio.TerrainGrass)
+		for i, route := range drawnRoutes {
+			if x == i {
+				tileData.SetRouteMask(route, 1<<fileio.DirectionNorth|1<<fileio.DirectionSouth)
+			}
+		}
+	})
+	unit := &fileio.UnitData{X: 2, Y: 1}
+	copy(unit.Name[:], "1st Division")
+	mapData.AllUnitData = []*fileio.UnitData{unit}
+	location := fileio.LocationData{X: 3, Y: 2}
+	copy(location.Name[:], "Warsaw")
+	mapData.AllLocationData = []fileio.LocationData{location}
+	return mapData
+}
+
+func TestDrawMapLayers(t *testing.T) {
+	// The groups the svg has for each layer
+	groups := map[Layer][]string{
+		LayerTerrain:   {"terrain"},
+		LayerRivers:    {"river", "major_river"},
+		LayerRoads:     {"road"},
+		LayerRailroads: {"railroad"},
+		LayerUnits:     {"units"},
+		LayerLabels:    {"labels"},
+	}
+	mapData := layerMapData()
+	groupColorMap := unitGroupColors(mapData)
+	imageWidth, imageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, defaultRadius)
+	for _, list := range []string{"all", "-units", "terrain,labels", "rivers,rails", "-terrain,-roads"} {
+		layers, err := ParseLayers(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newSVGRenderer(int(imageWidth), int(imageHeight))
+		drawMap(r, mapData, groupColorMap, defaultRadius, layers)
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		svg := buf.String()
+
+		// The routes group is always there, with a group for each drawn route
+		if count := strings.Count(svg, `<g id="routes">`); count != 1 {
+			t.Errorf("%q: found %d route groups", list, count)
+		}
+		drawnGroups := 1
+		for _, layer := range AllLayers {
+			expected := 0
+			if layers.Has(layer) {
+				expected = 1
+				drawnGroups += len(groups[layer])
+			}
+			for _, id := range groups[layer] {
+				if count := strings.Count(svg, `<g id="`+id+`">`); count != expected {
+					t.Errorf("%q: found %d %s groups, expected %d", list, count, id, expected)
+				}
+			}
+		}
+		if count := strings.Count(svg, "<g "); count != drawnGroups {
+			t.Errorf("%q: found %d groups, expected %d", list, count, drawnGroups)
+		}
+
+		// The shapes of a layer that isn't drawn are left out as well
+		if strings.Contains(svg, "Warsaw") != layers.Has(LayerLabels) {
+			t.Errorf("%q: labels are drawn: %v", list, strings.Contains(svg, "Warsaw"))
+		}
+		if strings.Contains(svg, "1st Division") != layers.Has(LayerUnits) {
+			t.Errorf("%q: units are drawn: %v", list, strings.Contains(svg, "1st Division"))
+		}
+		if strings.Contains(svg, `class="route-road"`) != layers.Has(LayerRoads) {
+			t.Errorf("%q: roads are drawn: %v", list, strings.Contains(svg, `class="route-road"`))
+		}
+	}
+}
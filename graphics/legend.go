@@ -0,0 +1,144 @@
+package graphics
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+	"github.com/samuelyuan/TOAWMap/palette"
+)
+
+// Sizes of the legend in the units of the renderer it is drawn on
+const (
+	legendRowHeight  = 14.0
+	legendSwatchSize = 10.0
+	legendFontSize   = 8.0
+	legendTitleSize  = 10.0
+)
+
+var legendTextColor = color.RGBA{0, 0, 0, 255}
+
+const unitsSectionTitle = "Units"
+
+type legendEntry struct {
+	label string
+	// draw draws the swatch of the entry in the square at (x, y)
+	draw func(r Renderer, x float64, y float64)
+}
+
+type legendSection struct {
+	title   string
+	entries []legendEntry
+}
+
+// legendLabel converts a terrain or route name like "deep_water" to "Deep water".
+func legendLabel(name string) string {
+	label := strings.ReplaceAll(name, "_", " ")
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+func fillSwatch(fill color.Color) func(r Renderer, x float64, y float64) {
+	return func(r Renderer, x float64, y float64) {
+		r.Rectangle(x, y, legendSwatchSize, legendSwatchSize, Style{Fill: fill})
+	}
+}
+
+// legendSections lists the terrain, the routes and the color groups with units on the map,
+// for the layers in the set.
+func legendSections(mapData *fileio.TOAWMapData, groupColorMap map[int]GroupColor, layers LayerSet) []legendSection {
+	var sections []legendSection
+	terrain := legendSection{title: "Terrain"}
+	for _, t := range fileio.AllTerrains {
+		if t == fileio.TerrainEmpty {
+			continue
+		}
+		terrain.entries = append(terrain.entries, legendEntry{legendLabel(string(t)), fillSwatch(palette.TerrainColors[t])})
+	}
+	terrain.entries = append(terrain.entries,
+		legendEntry{"Forest", fillSwatch(palette.ForestColor)},
+		legendEntry{"Urban", func(r Renderer, x float64, y float64) {
+			r.Rectangle(x, y, legendSwatchSize, legendSwatchSize, Style{Fill: palette.TerrainColors[fileio.TerrainGrass]})
+			r.Rectangle(x+legendSwatchSize/4, y+legendSwatchSize/4, legendSwatchSize/2, legendSwatchSize/2, Style{Fill: palette.UrbanColor})
+		}},
+	)
+	// Terrain subtypes are only listed when the theme gives them their own color
+	for _, feature := range fileio.AllFeatures {
+		if c, ok := palette.FeatureColors[feature]; ok {
+			terrain.entries = append(terrain.entries, legendEntry{legendLabel(string(feature)), fillSwatch(c)})
+		}
+	}
+
+	if layers.Has(LayerTerrain) {
+		sections = append(sections, terrain)
+	}
+
+	routes := legendSection{title: "Routes"}
+	for _, route := range drawnRoutes {
+		if !layers.Has(routeLayers[route]) {
+			continue
+		}
+		stroke := palette.RouteColors[route]
+		routes.entries = append(routes.entries, legendEntry{legendLabel(string(route)), func(r Renderer, x float64, y float64) {
+			r.Line(x, y+legendSwatchSize/2, x+legendSwatchSize, y+legendSwatchSize/2, Style{Stroke: stroke, LineWidth: 2})
+		}})
+	}
+
+	if len(routes.entries) > 0 {
+		sections = append(sections, routes)
+	}
+
+	groups := make(map[int]bool)
+	for _, unitData := range mapData.AllUnitData {
+		if unitData.IsOnMap() {
+			groups[unitData.ColorGroup()] = true
+		}
+	}
+	if len(groups) > 0 && layers.Has(LayerUnits) {
+		units := legendSection{title: unitsSectionTitle}
+		groupIds := make([]int, 0, len(groups))
+		for group := range groups {
+			groupIds = append(groupIds, group)
+		}
+		sort.Ints(groupIds)
+		for _, group := range groupIds {
+			groupColor := groupColorMap[group]
+			units.entries = append(units.entries, legendEntry{fmt.Sprintf("Color group %d", group), func(r Renderer, x float64, y float64) {
+				r.Rectangle(x, y, legendSwatchSize, legendSwatchSize, Style{Fill: groupColor.OuterColor})
+				r.Rectangle(x+legendSwatchSize/4, y+legendSwatchSize/4, legendSwatchSize/2, legendSwatchSize/2, Style{Fill: groupColor.InnerColor})
+			}})
+		}
+		sections = append(sections, units)
+	}
+	return sections
+}
+
+// legendHeight returns the height of a legend with the sections side by side.
+func legendHeight(sections []legendSection) float64 {
+	if len(sections) == 0 {
+		return 0
+	}
+	rows := 0
+	for _, section := range sections {
+		rows = max(rows, len(section.entries))
+	}
+	return legendRowHeight * float64(rows+1)
+}
+
+// drawLegend draws the sections side by side in columns of the given width, with the
+// upper left corner at (x, y).
+func drawLegend(r Renderer, sections []legendSection, x float64, y float64, columnWidth float64) {
+	r.BeginLayer("legend")
+	for i, section := range sections {
+		columnX := x + float64(i)*columnWidth
+		r.Text(section.title, columnX, y+legendTitleSize, Style{Class: "legend-title", Fill: legendTextColor, FontSize: legendTitleSize, LeftAligned: true})
+		for j, entry := range section.entries {
+			rowY := y + float64(j+1)*legendRowHeight
+			entry.draw(r, columnX, rowY)
+			r.Text(entry.label, columnX+legendSwatchSize+4, rowY+legendSwatchSize-1,
+				Style{Class: "legend-label", Fill: legendTextColor, FontSize: legendFontSize, LeftAligned: true})
+		}
+	}
+	r.EndLayer()
+}
@@ -0,0 +1,233 @@
+package graphics
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// Sizes of the legend margin before it is scaled, in the same units as the legend
+const (
+	marginPadding     = 10.0
+	marginTitleSize   = 16.0
+	marginSidesSize   = 9.0
+	marginNoteHeight  = 11.0
+	marginNoteWidth   = 230.0
+	marginColumnWidth = 110.0
+	scaleBarHeight    = 4.0
+)
+
+var (
+	marginBackground       = color.RGBA{255, 255, 255, 255}
+	scaleBarAlternateColor = color.RGBA{160, 160, 160, 255}
+)
+
+// scaledRenderer draws on another renderer with the positions and sizes scaled
+// and moved by an offset.
+type scaledRenderer struct {
+	r       Renderer
+	scale   float64
+	offsetX float64
+	offsetY float64
+}
+
+func (s scaledRenderer) point(x float64, y float64) (float64, float64) {
+	return s.offsetX + x*s.scale, s.offsetY + y*s.scale
+}
+
+func (s scaledRenderer) style(style Style) Style {
+	style.LineWidth *= s.scale
+	style.FontSize *= s.scale
+	return style
+}
+
+func (s scaledRenderer) BeginLayer(name string) {
+	s.r.BeginLayer(name)
+}
+
+func (s scaledRenderer) EndLayer() {
+	s.r.EndLayer()
+}
+
+func (s scaledRenderer) Polygon(points []Point, style Style) {
+	scaled := make([]Point, len(points))
+	for i, point := range points {
+		scaled[i].X, scaled[i].Y = s.point(point.X, point.Y)
+	}
+	s.r.Polygon(scaled, s.style(style))
+}
+
+func (s scaledRenderer) Line(x1 float64, y1 float64, x2 float64, y2 float64, style Style) {
+	x1, y1 = s.point(x1, y1)
+	x2, y2 = s.point(x2, y2)
+	s.r.Line(x1, y1, x2, y2, s.style(style))
+}
+
+func (s scaledRenderer) Rectangle(x float64, y float64, width float64, height float64, style Style) {
+	x, y = s.point(x, y)
+	s.r.Rectangle(x, y, width*s.scale, height*s.scale, s.style(style))
+}
+
+func (s scaledRenderer) Text(text string, x float64, y float64, style Style) {
+	x, y = s.point(x, y)
+	s.r.Text(text, x, y, s.style(style))
+}
+
+// mapTitle returns the title in the header of the map, or the name of the output file
+// if there is none.
+func mapTitle(mapData *fileio.TOAWMapData, outputFilename string) string {
+	if mapData.Header != nil && strings.TrimSpace(mapData.Header.TitleString(mapData.CodePage)) != "" {
+		return strings.TrimSpace(mapData.Header.TitleString(mapData.CodePage))
+	}
+	return strings.TrimSuffix(filepath.Base(outputFilename), filepath.Ext(outputFilename))
+}
+
+// sideNames returns the force and country of each side, like "Eighth Army (USA)".
+func sideNames(mapData *fileio.TOAWMapData) []string {
+	var names []string
+	for _, team := range mapData.AllTeamNameData {
+		if name := team.SideName(mapData.CodePage); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// scaleBarHexes returns the largest of 1, 2, 5, 10, 20, 50 and so on hexes that fits
+// in the length in pixels, or 1 if none of them fit.
+func scaleBarHexes(length float64, radius float64) int {
+	hexSize := math.Sqrt(3) * radius
+	best := 1
+	for step := 1; float64(step)*hexSize <= length; step *= 10 {
+		for _, n := range []int{step, 2 * step, 5 * step} {
+			if float64(n)*hexSize <= length {
+				best = n
+			}
+		}
+	}
+	return best
+}
+
+// colorGroupNote explains the unit colors of the legend, since the scenario doesn't
+// store which side a color group belongs to.
+var colorGroupNote = []string{
+	"Units are colored by color group.",
+	"The scenario doesn't store the side of each group.",
+}
+
+// mapMargin is the title block, legend and scale bar that are drawn below the map.
+type mapMargin struct {
+	title    string
+	sides    []string
+	note     []string
+	sections []legendSection
+	// scale is the size of a margin unit in image pixels
+	scale float64
+	// hexSizeKm is the distance between neighboring hex centers, 0 if it isn't known
+	hexSizeKm float64
+}
+
+func newMapMargin(mapData *fileio.TOAWMapData, title string, groupColorMap map[int]GroupColor, layers LayerSet, radius float64, hexSizeKm float64) mapMargin {
+	m := mapMargin{
+		title:     title,
+		sides:     sideNames(mapData),
+		sections:  legendSections(mapData, groupColorMap, layers),
+		scale:     1.5 * math.Max(1, radius/defaultRadius),
+		hexSizeKm: hexSizeKm,
+	}
+	for _, section := range m.sections {
+		if section.title == unitsSectionTitle {
+			m.note = colorGroupNote
+		}
+	}
+	return m
+}
+
+// noteTop returns the top of the note in margin units.
+func (m mapMargin) noteTop() float64 {
+	top := marginPadding + marginTitleSize + 6
+	if len(m.sides) > 0 {
+		top += marginSidesSize + 6
+	}
+	return top
+}
+
+// legendTop returns the top of the legend in margin units.
+func (m mapMargin) legendTop() float64 {
+	top := m.noteTop()
+	if len(m.note) > 0 {
+		top += float64(len(m.note))*marginNoteHeight + 4
+	}
+	return top
+}
+
+// fitWidth makes the margin smaller if it is wider than the image width in pixels.
+func (m *mapMargin) fitWidth(imageWidth float64) {
+	if width, _ := m.size(); width > imageWidth {
+		m.scale *= imageWidth / width
+	}
+}
+
+// size returns the size of the margin in image pixels.
+func (m mapMargin) size() (float64, float64) {
+	width := 2*marginPadding + math.Max(1, float64(len(m.sections)))*marginColumnWidth
+	if len(m.note) > 0 {
+		width = math.Max(width, 2*marginPadding+marginNoteWidth)
+	}
+	height := m.legendTop() + legendHeight(m.sections) + 2*legendRowHeight + scaleBarHeight + marginPadding
+	return width * m.scale, height * m.scale
+}
+
+// draw draws the margin with its upper left corner at the pixel (0, top) of an image
+// of the given width, for a map with hexes of the given radius.
+func (m mapMargin) draw(r Renderer, top float64, imageWidth float64, radius float64) {
+	_, height := m.size()
+	r.BeginLayer("margin")
+	r.Rectangle(0, top, imageWidth, height, Style{Class: "margin", Fill: marginBackground})
+
+	s := scaledRenderer{r: r, scale: m.scale, offsetY: top}
+	s.Text(m.title, marginPadding, marginPadding+marginTitleSize,
+		Style{Class: "margin-title", Fill: legendTextColor, FontSize: marginTitleSize, LeftAligned: true})
+	if len(m.sides) > 0 {
+		s.Text("Sides: "+strings.Join(m.sides, " - "), marginPadding, marginPadding+marginTitleSize+6+marginSidesSize,
+			Style{Class: "margin-sides", Fill: legendTextColor, FontSize: marginSidesSize, LeftAligned: true})
+	}
+	for i, line := range m.note {
+		s.Text(line, marginPadding, m.noteTop()+float64(i+1)*marginNoteHeight-3,
+			Style{Class: "legend-label", Fill: legendTextColor, FontSize: legendFontSize, LeftAligned: true})
+	}
+	drawLegend(s, m.sections, marginPadding, m.legendTop(), marginColumnWidth)
+
+	// The scale bar is measured in image pixels, so it matches the hexes of the map
+	barTop := m.legendTop() + legendHeight(m.sections) + legendRowHeight
+	hexes := scaleBarHexes(imageWidth/3, radius)
+	segments := hexes
+	if hexes > 5 {
+		segments = 5
+	}
+	segmentLength := float64(hexes) * math.Sqrt(3) * radius / float64(segments)
+	barX, barY := marginPadding*m.scale, top+barTop*m.scale
+	for i := 0; i < segments; i++ {
+		style := Style{Class: "scale-bar", Fill: legendTextColor}
+		if i%2 == 1 {
+			style = Style{Class: "scale-bar alternate", Fill: scaleBarAlternateColor}
+		}
+		r.Rectangle(barX+float64(i)*segmentLength, barY, segmentLength, scaleBarHeight*m.scale, style)
+	}
+
+	label := fmt.Sprintf("%d hexes", hexes)
+	if hexes == 1 {
+		label = "1 hex"
+	}
+	if m.hexSizeKm > 0 {
+		label += " = " + strconv.FormatFloat(math.Round(float64(hexes)*m.hexSizeKm*100)/100, 'f', -1, 64) + " km"
+	}
+	r.Text(label, barX+float64(segments)*segmentLength+4*m.scale, barY+scaleBarHeight*m.scale,
+		Style{Class: "legend-label", Fill: legendTextColor, FontSize: legendFontSize * m.scale, LeftAligned: true})
+	r.EndLayer()
+}
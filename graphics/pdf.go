@@ -0,0 +1,253 @@
+package graphics
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// Widths of the printable ASCII characters of Helvetica, in 1/1000 of the font size.
+// Other characters are assumed to be as wide as a digit.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556,
+	278, 278, 584, 584, 584, 556, 1015,
+	667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833,
+	722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611,
+	278, 278, 278, 469, 556, 333,
+	556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833,
+	556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500,
+	334, 260, 334, 584,
+}
+
+// pdfTextWidth returns the width of Windows-1252 text in Helvetica.
+func pdfTextWidth(text []byte, fontSize float64) float64 {
+	width := 0
+	for _, b := range text {
+		if b >= 0x20 && b < 0x7f {
+			width += helveticaWidths[b-0x20]
+		} else {
+			width += 556
+		}
+	}
+	return float64(width) * fontSize / 1000
+}
+
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 32)
+}
+
+func pdfColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return pdfNumber(float64(r)/0xffff) + " " + pdfNumber(float64(g)/0xffff) + " " + pdfNumber(float64(b)/0xffff)
+}
+
+// pdfRenderer writes the content stream of a page. The shapes are given in image
+// pixels, which the page converts to points with a transform at the start of the stream.
+type pdfRenderer struct {
+	content bytes.Buffer
+	// The last colors and line width that were set, so they aren't repeated for every shape
+	fill      string
+	stroke    string
+	lineWidth float64
+	// Shapes outside of the clip rectangle are left out, so pages of a large map
+	// only have the shapes they show
+	clip *[4]float64
+}
+
+// newPDFRenderer starts a page of the given height in points, where one image pixel is
+// scale points and the image pixel (offsetX, offsetY) is in the upper left corner.
+func newPDFRenderer(pageHeight float64, scale float64, offsetX float64, offsetY float64) *pdfRenderer {
+	r := &pdfRenderer{lineWidth: -1}
+	// Flip the y axis so it points down like in the image, and use round line caps like gg
+	fmt.Fprintf(&r.content, "q %s 0 0 %s %s %s cm 1 J\n", pdfNumber(scale), pdfNumber(-scale),
+		pdfNumber(0-offsetX*scale), pdfNumber(pageHeight+offsetY*scale))
+	return r
+}
+
+// Clip limits the drawing to a rectangle in image pixels.
+func (r *pdfRenderer) Clip(x float64, y float64, width float64, height float64) {
+	r.clip = &[4]float64{x, y, x + width, y + height}
+	fmt.Fprintf(&r.content, "%s %s %s %s re W n\n", pdfNumber(x), pdfNumber(y), pdfNumber(width), pdfNumber(height))
+}
+
+// visible reports whether a bounding box is at least partly inside the clip rectangle.
+func (r *pdfRenderer) visible(minX float64, minY float64, maxX float64, maxY float64) bool {
+	return r.clip == nil || (maxX >= r.clip[0] && minX <= r.clip[2] && maxY >= r.clip[1] && minY <= r.clip[3])
+}
+
+func (r *pdfRenderer) setFill(c color.Color) {
+	if fill := pdfColor(c); fill != r.fill {
+		r.fill = fill
+		fmt.Fprintf(&r.content, "%s rg\n", fill)
+	}
+}
+
+func (r *pdfRenderer) setStroke(c color.Color, lineWidth float64) {
+	if stroke := pdfColor(c); stroke != r.stroke {
+		r.stroke = stroke
+		fmt.Fprintf(&r.content, "%s RG\n", stroke)
+	}
+	if lineWidth != r.lineWidth {
+		r.lineWidth = lineWidth
+		fmt.Fprintf(&r.content, "%s w\n", pdfNumber(lineWidth))
+	}
+}
+
+// PDF has optional content groups for layers, but not every viewer shows them,
+// so the shapes are drawn in one group.
+func (r *pdfRenderer) BeginLayer(name string) {}
+
+func (r *pdfRenderer) EndLayer() {}
+
+func (r *pdfRenderer) Polygon(points []Point, style Style) {
+	if style.Fill == nil || len(points) == 0 {
+		return
+	}
+	minX, minY, maxX, maxY := points[0].X, points[0].Y, points[0].X, points[0].Y
+	for _, point := range points {
+		minX, minY = math.Min(minX, point.X), math.Min(minY, point.Y)
+		maxX, maxY = math.Max(maxX, point.X), math.Max(maxY, point.Y)
+	}
+	if !r.visible(minX, minY, maxX, maxY) {
+		return
+	}
+	r.setFill(style.Fill)
+	for i, point := range points {
+		operator := "l"
+		if i == 0 {
+			operator = "m"
+		}
+		fmt.Fprintf(&r.content, "%s %s %s ", pdfNumber(point.X), pdfNumber(point.Y), operator)
+	}
+	r.content.WriteString("h f\n")
+}
+
+func (r *pdfRenderer) Line(x1 float64, y1 float64, x2 float64, y2 float64, style Style) {
+	if style.Stroke == nil || !r.visible(math.Min(x1, x2), math.Min(y1, y2), math.Max(x1, x2), math.Max(y1, y2)) {
+		return
+	}
+	r.setStroke(style.Stroke, style.LineWidth)
+	fmt.Fprintf(&r.content, "%s %s m %s %s l S\n", pdfNumber(x1), pdfNumber(y1), pdfNumber(x2), pdfNumber(y2))
+}
+
+func (r *pdfRenderer) Rectangle(x float64, y float64, width float64, height float64, style Style) {
+	if style.Fill == nil || !r.visible(x, y, x+width, y+height) {
+		return
+	}
+	r.setFill(style.Fill)
+	fmt.Fprintf(&r.content, "%s %s %s %s re f\n", pdfNumber(x), pdfNumber(y), pdfNumber(width), pdfNumber(height))
+}
+
+// Text uses Helvetica, which every PDF viewer has, with the Windows-1252 characters.
+func (r *pdfRenderer) Text(s string, x float64, y float64, style Style) {
+	if style.Fill == nil || s == "" {
+		return
+	}
+	text := fileio.EncodeWindows1252(s)
+	width := pdfTextWidth(text, style.FontSize)
+	if !style.LeftAligned {
+		x -= width / 2
+	}
+	if !r.visible(x, y-style.FontSize, x+width, y+style.FontSize/2) {
+		return
+	}
+	r.setFill(style.Fill)
+	// The text matrix flips the text back, since the y axis points down
+	fmt.Fprintf(&r.content, "BT /F1 %s Tf 1 0 0 -1 %s %s Tm <%x> Tj ET\n", pdfNumber(style.FontSize),
+		pdfNumber(x), pdfNumber(y), text)
+}
+
+// Bytes ends the page and returns its content stream.
+func (r *pdfRenderer) Bytes() []byte {
+	r.content.WriteString("Q\n")
+	return r.content.Bytes()
+}
+
+type pdfPage struct {
+	width   float64
+	height  float64
+	content []byte
+}
+
+// pdfDocument is a minimal PDF writer for pages of vector shapes and text in Helvetica.
+type pdfDocument struct {
+	pages []pdfPage
+}
+
+// AddPage adds a page with the size in points and its content stream.
+func (d *pdfDocument) AddPage(width float64, height float64, content []byte) {
+	d.pages = append(d.pages, pdfPage{width: width, height: height, content: content})
+}
+
+// countingWriter keeps track of the offsets of the objects for the cross reference table
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo writes the document. The objects are the catalog, the page tree and the font,
+// then a page and its compressed content stream for every page.
+func (d *pdfDocument) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	objectCount := 3 + 2*len(d.pages)
+	offsets := make([]int64, objectCount+1)
+	startObject := func(id int) {
+		offsets[id] = cw.n
+		fmt.Fprintf(cw, "%d 0 obj\n", id)
+	}
+
+	fmt.Fprint(cw, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	startObject(1)
+	fmt.Fprint(cw, "<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	startObject(2)
+	fmt.Fprint(cw, "<< /Type /Pages /Kids [")
+	for i := range d.pages {
+		fmt.Fprintf(cw, " %d 0 R", 4+2*i)
+	}
+	fmt.Fprintf(cw, " ] /Count %d >>\nendobj\n", len(d.pages))
+
+	startObject(3)
+	fmt.Fprint(cw, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\nendobj\n")
+
+	for i, page := range d.pages {
+		pageId := 4 + 2*i
+		startObject(pageId)
+		fmt.Fprintf(cw, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pdfNumber(page.width), pdfNumber(page.height), pageId+1)
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.content); err != nil {
+			return cw.n, err
+		}
+		if err := zw.Close(); err != nil {
+			return cw.n, err
+		}
+		startObject(pageId + 1)
+		fmt.Fprintf(cw, "<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+		cw.Write(compressed.Bytes())
+		fmt.Fprint(cw, "\nendstream\nendobj\n")
+	}
+
+	xrefOffset := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", objectCount+1)
+	for id := 1; id <= objectCount; id++ {
+		fmt.Fprintf(cw, "%010d 00000 n \n", offsets[id])
+	}
+	_, err := fmt.Fprintf(cw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", objectCount+1, xrefOffset)
+	return cw.n, err
+}
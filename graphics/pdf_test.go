@@ -0,0 +1,127 @@
+package graphics
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// smallMapData returns a map with every terrain and a road, which fits on a few pages.
+func smallMapData(width int, height int) *fileio.TOAWMapData {
+	grid := fileio.NewTileGrid(width, height, 48)
+	grid.Each(func(x int, y int, tileData fileio.TileData) {
+		tileData.SetTerrain(fileio.AllTerrains[(x+y)%len(fileio.AllTerrains)])
+		if x == width/2 {
+			tileData.SetRouteMask(fileio.RouteRoad, 1<<fileio.DirectionNorth|1<<fileio.DirectionSouth)
+		}
+	})
+	return &fileio.TOAWMapData{Version: 4, AllTileData: grid, MapWidth: width, MapHeight: height}
+}
+
+func TestPagesAlong(t *testing.T) {
+	for _, test := range []struct {
+		length, area, overlap float64
+		pages                 int
+	}{
+		{0, 40, 10, 1},
+		{40, 40, 10, 1},
+		{41, 40, 10, 2},
+		{70, 40, 10, 2},
+		{100, 40, 10, 3},
+	} {
+		if pages := pagesAlong(test.length, test.area, test.overlap); pages != test.pages {
+			t.Errorf("%v on pages of %v with %v overlap takes %d pages, expected %d", test.length, test.area, test.overlap, pages, test.pages)
+		}
+	}
+}
+
+func TestPrintDocument(t *testing.T) {
+	mapData := smallMapData(30, 20)
+	options := PrintOptions{Paper: "a4", HexSizeMm: 12, OverlapMm: 5}
+	document, err := printDocument(mapData, "Test", nil, options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageWidth, imageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, defaultRadius)
+	layout, _ := newPrintLayout(imageWidth, imageHeight, options)
+	mapPages := layout.columns * layout.rows
+	if mapPages < 2 {
+		t.Fatalf("the map fits on %d page, expected several", mapPages)
+	}
+
+	var buf bytes.Buffer
+	n, err := document.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+	if n != int64(len(pdf)) {
+		t.Errorf("WriteTo returned %d bytes, but wrote %d", n, len(pdf))
+	}
+
+	// The cover page and a page for each part of the map
+	pageCount := 1 + mapPages
+	if count := bytes.Count(pdf, []byte("/Type /Page ")); count != pageCount {
+		t.Errorf("found %d pages, expected %d", count, pageCount)
+	}
+	if !bytes.Contains(pdf, []byte(fmt.Sprintf("/Count %d >>", pageCount))) {
+		t.Errorf("the page tree doesn't count %d pages", pageCount)
+	}
+
+	// startxref points at the table, and the table at every object
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("no startxref at the end of the file")
+	}
+	xrefOffset, _ := strconv.Atoi(string(match[1]))
+	objectCount := 3 + 2*pageCount
+	header := fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", objectCount+1)
+	if !bytes.HasPrefix(pdf[xrefOffset:], []byte(header)) {
+		t.Fatalf("startxref %d doesn't point at the cross reference table", xrefOffset)
+	}
+	entries := pdf[xrefOffset+len(header):]
+	for id := 1; id <= objectCount; id++ {
+		entry := string(entries[(id-1)*20 : id*20])
+		offset, err := strconv.Atoi(entry[:10])
+		if err != nil || entry[10:] != " 00000 n \n" {
+			t.Fatalf("entry %d is %q", id, entry)
+		}
+		if object := fmt.Sprintf("%d 0 obj\n", id); !bytes.HasPrefix(pdf[offset:], []byte(object)) {
+			t.Errorf("object %d is not at offset %d", id, offset)
+		}
+	}
+	if !bytes.HasPrefix(entries[objectCount*20:], []byte(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>", objectCount+1))) {
+		t.Error("the cross reference table has more entries than objects")
+	}
+
+	// Every content stream has its length and can be decompressed
+	streams := regexp.MustCompile(`<< /Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindAllSubmatchIndex(pdf, -1)
+	if len(streams) != pageCount {
+		t.Fatalf("found %d content streams, expected %d", len(streams), pageCount)
+	}
+	for i, stream := range streams {
+		length, _ := strconv.Atoi(string(pdf[stream[2]:stream[3]]))
+		data := pdf[stream[1] : stream[1]+length]
+		if !bytes.HasPrefix(pdf[stream[1]+length:], []byte("\nendstream\n")) {
+			t.Errorf("stream %d doesn't end after %d bytes", i, length)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		// The text is written in hex
+		if i > 0 && !bytes.Contains(content, []byte(fmt.Sprintf("<%x", fmt.Sprintf("Page %d of %d", i, mapPages)))) {
+			t.Errorf("stream %d doesn't have the index of page %d", i, i)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package graphics
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// PaperSize is the size of a sheet of paper in points, in portrait orientation.
+type PaperSize struct {
+	Width  float64
+	Height float64
+}
+
+// PaperSizes has the paper sizes that can be printed on.
+var PaperSizes = map[string]PaperSize{
+	"a4":     {595.28, 841.89},
+	"a3":     {841.89, 1190.55},
+	"letter": {612, 792},
+}
+
+// PrintOptions split the map across pages of paper, for PDF output.
+type PrintOptions struct {
+	// Paper is the name of a paper size in PaperSizes
+	Paper string
+	// HexSizeMm is the distance between the centers of neighboring hexes on paper
+	HexSizeMm float64
+	// OverlapMm is the width of the strip of the map that is printed on both of two
+	// neighboring pages
+	OverlapMm float64
+}
+
+// Space around the map on every page in points, which has the marks and the page index
+const (
+	printMargin       = 28.0
+	printHeaderHeight = 12.0
+	pointsPerMm       = 72 / 25.4
+)
+
+var (
+	printMarkColor = color.RGBA{0, 0, 0, 255}
+	printGridColor = color.RGBA{255, 255, 255, 255}
+)
+
+// printLayout is the position of every page on the map.
+type printLayout struct {
+	paperName  string
+	pageWidth  float64
+	pageHeight float64
+	// scale is the number of points per image pixel
+	scale float64
+	// Size of the part of the map on each page in points
+	areaWidth  float64
+	areaHeight float64
+	overlap    float64
+	columns    int
+	rows       int
+}
+
+// pagesAlong returns the number of pages needed to cover a length with the given
+// area on each page, where neighboring pages overlap.
+func pagesAlong(length float64, area float64, overlap float64) int {
+	return max(1, int(math.Ceil((length-overlap)/(area-overlap)-1e-9)))
+}
+
+// newPrintLayout splits an image of the given size in pixels into pages, in the paper
+// orientation that needs fewer pages.
+func newPrintLayout(imageWidth float64, imageHeight float64, options PrintOptions) (printLayout, error) {
+	paper, ok := PaperSizes[strings.ToLower(options.Paper)]
+	if !ok {
+		return printLayout{}, fmt.Errorf("unknown paper size %s, expected a4, a3 or letter", options.Paper)
+	}
+	if options.HexSizeMm <= 0 {
+		return printLayout{}, fmt.Errorf("the hex size must be greater than 0")
+	}
+
+	// Neighboring hexes in a column are the height of a hex apart
+	scale := options.HexSizeMm * pointsPerMm / (math.Sqrt(3) * defaultRadius)
+	overlap := math.Max(options.OverlapMm, 0) * pointsPerMm
+	var best printLayout
+	for _, size := range []PaperSize{paper, {paper.Height, paper.Width}} {
+		layout := printLayout{
+			paperName:  strings.ToUpper(options.Paper[:1]) + options.Paper[1:],
+			pageWidth:  size.Width,
+			pageHeight: size.Height,
+			scale:      scale,
+			areaWidth:  size.Width - 2*printMargin,
+			areaHeight: size.Height - 2*printMargin - printHeaderHeight,
+			overlap:    overlap,
+		}
+		if overlap >= layout.areaWidth/2 || overlap >= layout.areaHeight/2 {
+			return printLayout{}, fmt.Errorf("the overlap must be less than half of the page")
+		}
+		layout.columns = pagesAlong(imageWidth*scale, layout.areaWidth, overlap)
+		layout.rows = pagesAlong(imageHeight*scale, layout.areaHeight, overlap)
+		if best.columns == 0 || layout.columns*layout.rows < best.columns*best.rows {
+			best = layout
+		}
+	}
+	return best, nil
+}
+
+// pageOrigin returns the image pixel in the upper left corner of the map area of a page.
+func (l printLayout) pageOrigin(row int, column int) (float64, float64) {
+	return float64(column) * (l.areaWidth - l.overlap) / l.scale, float64(row) * (l.areaHeight - l.overlap) / l.scale
+}
+
+func (l printLayout) pageNumber(row int, column int) int {
+	return row*l.columns + column + 1
+}
+
+// visibleHexes returns the first and last hex with its center in a range of image pixels.
+func visibleHexes(from float64, to float64, first float64, spacing float64, count int) (int, int) {
+	start := max(0, int(math.Ceil((from-first)/spacing)))
+	end := min(count-1, int(math.Floor((to-first)/spacing)))
+	return start, end
+}
+
+func (l printLayout) visibleColumns(originX float64, mapWidth int) (int, int) {
+	return visibleHexes(originX, originX+l.areaWidth/l.scale, defaultRadius, defaultRadius*1.5, mapWidth)
+}
+
+func (l printLayout) visibleRows(originY float64, mapHeight int) (int, int) {
+	return visibleHexes(originY, originY+l.areaHeight/l.scale, defaultRadius*1.5, defaultRadius*math.Sqrt(3), mapHeight)
+}
+
+func printText(r Renderer, s string, x float64, y float64, fontSize float64) {
+	r.Text(s, x, y, Style{Fill: printMarkColor, FontSize: fontSize})
+}
+
+func printLine(r Renderer, x1 float64, y1 float64, x2 float64, y2 float64) {
+	r.Line(x1, y1, x2, y2, Style{Stroke: printMarkColor, LineWidth: 0.5})
+}
+
+// drawPageMarks draws crop marks at the corners of the map area, ticks where the
+// overlap with the next page starts, the hex coordinates along the edges and the page index.
+func drawPageMarks(r Renderer, l printLayout, row int, column int, mapData *fileio.TOAWMapData) {
+	left, top := printMargin, printMargin+printHeaderHeight
+	right, bottom := left+l.areaWidth, top+l.areaHeight
+	originX, originY := l.pageOrigin(row, column)
+
+	const markGap, markLength = 3.0, 10.0
+	for _, x := range []float64{left, right} {
+		for _, y := range []float64{top, bottom} {
+			dx, dy := math.Copysign(1, x-left-0.5), math.Copysign(1, y-top-0.5)
+			printLine(r, x+dx*markGap, y, x+dx*(markGap+markLength), y)
+			printLine(r, x, y+dy*markGap, x, y+dy*(markGap+markLength))
+		}
+	}
+	if column < l.columns-1 {
+		x := right - l.overlap
+		printLine(r, x, top-markGap-markLength, x, top-markGap)
+		printLine(r, x, bottom+markGap, x, bottom+markGap+markLength)
+	}
+	if row < l.rows-1 {
+		y := bottom - l.overlap
+		printLine(r, left-markGap-markLength, y, left-markGap, y)
+		printLine(r, right+markGap, y, right+markGap+markLength, y)
+	}
+
+	// Hex coordinates of every fifth column and row
+	firstColumn, lastColumn := l.visibleColumns(originX, mapData.MapWidth)
+	for x := firstColumn; x <= lastColumn; x++ {
+		if x%5 == 0 {
+			imageX, _ := getImagePosition(0, x, defaultRadius)
+			printText(r, fmt.Sprint(x), left+(imageX-originX)*l.scale, top-2, 6)
+		}
+	}
+	firstRow, lastRow := l.visibleRows(originY, mapData.MapHeight)
+	for y := firstRow; y <= lastRow; y++ {
+		if y%5 == 0 {
+			_, imageY := getImagePosition(y, 0, defaultRadius)
+			printText(r, fmt.Sprint(y), left/2, top+(imageY-originY)*l.scale+2, 6)
+		}
+	}
+
+	pageCount := l.columns * l.rows
+	printText(r, fmt.Sprintf("Page %d of %d - row %d, column %d - hexes x %d-%d, y %d-%d",
+		l.pageNumber(row, column), pageCount, row+1, column+1, firstColumn, lastColumn, firstRow, lastRow),
+		l.pageWidth/2, printMargin, 8)
+
+	neighbors := []string{}
+	for _, neighbor := range []struct {
+		name        string
+		row, column int
+	}{{"above", row - 1, column}, {"left", row, column - 1}, {"right", row, column + 1}, {"below", row + 1, column}} {
+		if neighbor.row >= 0 && neighbor.row < l.rows && neighbor.column >= 0 && neighbor.column < l.columns {
+			neighbors = append(neighbors, fmt.Sprintf("%s: page %d", neighbor.name, l.pageNumber(neighbor.row, neighbor.column)))
+		}
+	}
+	if len(neighbors) > 0 {
+		printText(r, "Continues "+strings.Join(neighbors, ", "), l.pageWidth/2, bottom+printMargin/2+4, 7)
+	}
+}
+
+// drawCoverPage draws the title, a small map with the outline and number of every page,
+// and the legend.
+func drawCoverPage(r Renderer, l printLayout, mapData *fileio.TOAWMapData, title string, groupColorMap map[int]GroupColor, layers LayerSet, imageWidth float64, imageHeight float64) *pdfRenderer {
+	printText(r, title, l.pageWidth/2, printMargin+20, 20)
+	printText(r, fmt.Sprintf("%dx%d hexes on %d %s pages, %d across and %d down, %.1f mm per hex",
+		mapData.MapWidth, mapData.MapHeight, l.columns*l.rows, l.paperName, l.columns, l.rows, math.Sqrt(3)*defaultRadius*l.scale/pointsPerMm),
+		l.pageWidth/2, printMargin+40, 10)
+
+	sections := legendSections(mapData, groupColorMap, layers)
+	boxTop := printMargin + 56
+	boxWidth := l.pageWidth - 2*printMargin
+	boxHeight := l.pageHeight - boxTop - printMargin - legendHeight(sections) - 16
+	thumbnailScale := math.Min(boxWidth/imageWidth, boxHeight/imageHeight)
+	thumbnailX := printMargin + (boxWidth-imageWidth*thumbnailScale)/2
+
+	// The map is drawn in its own content stream, which is scaled to fit the box
+	thumbnail := newPDFRenderer(l.pageHeight, thumbnailScale, -thumbnailX/thumbnailScale, -boxTop/thumbnailScale)
+	thumbnail.Clip(0, 0, imageWidth, imageHeight)
+	drawMap(thumbnail, mapData, groupColorMap, defaultRadius, layers)
+
+	for row := 0; row < l.rows; row++ {
+		for column := 0; column < l.columns; column++ {
+			originX, originY := l.pageOrigin(row, column)
+			x1 := thumbnailX + originX*thumbnailScale
+			y1 := boxTop + originY*thumbnailScale
+			x2 := thumbnailX + math.Min(originX+l.areaWidth/l.scale, imageWidth)*thumbnailScale
+			y2 := boxTop + math.Min(originY+l.areaHeight/l.scale, imageHeight)*thumbnailScale
+			style := Style{Stroke: printGridColor, LineWidth: 0.75}
+			r.Line(x1, y1, x2, y1, style)
+			r.Line(x2, y1, x2, y2, style)
+			r.Line(x2, y2, x1, y2, style)
+			r.Line(x1, y2, x1, y1, style)
+			r.Text(fmt.Sprint(l.pageNumber(row, column)), (x1+x2)/2, (y1+y2)/2+4, Style{Fill: printGridColor, FontSize: 10})
+		}
+	}
+
+	legendTop := boxTop + imageHeight*thumbnailScale + 16
+	drawLegend(r, sections, printMargin, legendTop, boxWidth/float64(len(sections)))
+	return thumbnail
+}
+
+// printDocument draws the cover page and then every page of the map.
+func printDocument(mapData *fileio.TOAWMapData, title string, groupColorMap map[int]GroupColor, options PrintOptions, layers LayerSet) (*pdfDocument, error) {
+	imageWidth, imageHeight := getImagePosition(mapData.MapHeight, mapData.MapWidth, defaultRadius)
+	layout, err := newPrintLayout(imageWidth, imageHeight, options)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Printing on %d pages of %s paper\n", layout.columns*layout.rows, layout.paperName)
+
+	document := &pdfDocument{}
+	cover := newPDFRenderer(layout.pageHeight, 1, 0, 0)
+	thumbnail := drawCoverPage(cover, layout, mapData, title, groupColorMap, layers, imageWidth, imageHeight)
+	document.AddPage(layout.pageWidth, layout.pageHeight, append(thumbnail.Bytes(), cover.Bytes()...))
+
+	for row := 0; row < layout.rows; row++ {
+		for column := 0; column < layout.columns; column++ {
+			originX, originY := layout.pageOrigin(row, column)
+			top := printMargin + printHeaderHeight
+			page := newPDFRenderer(layout.pageHeight, layout.scale, originX-printMargin/layout.scale, originY-top/layout.scale)
+			page.Clip(originX, originY, layout.areaWidth/layout.scale, layout.areaHeight/layout.scale)
+			drawMap(page, mapData, groupColorMap, defaultRadius, layers)
+
+			marks := newPDFRenderer(layout.pageHeight, 1, 0, 0)
+			drawPageMarks(marks, layout, row, column, mapData)
+			document.AddPage(layout.pageWidth, layout.pageHeight, append(page.Bytes(), marks.Bytes()...))
+		}
+	}
+	return document, nil
+}
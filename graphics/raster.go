@@ -0,0 +1,101 @@
+package graphics
+
+import (
+	"log"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// rasterRenderer draws with gg, for PNG and GeoTIFF output.
+type rasterRenderer struct {
+	dc *gg.Context
+	// The font faces of the text sizes that were drawn, except the default label size
+	faces map[float64]font.Face
+}
+
+func newRasterRenderer(width int, height int) *rasterRenderer {
+	return &rasterRenderer{dc: gg.NewContext(width, height), faces: make(map[float64]font.Face)}
+}
+
+var goRegular *truetype.Font
+
+// face returns Go Regular in the given size in pixels.
+func (r *rasterRenderer) face(size float64) font.Face {
+	if face, ok := r.faces[size]; ok {
+		return face
+	}
+	if goRegular == nil {
+		var err error
+		if goRegular, err = truetype.Parse(goregular.TTF); err != nil {
+			log.Fatal("Failed to load font: ", err)
+		}
+	}
+	face := truetype.NewFace(goRegular, &truetype.Options{Size: size})
+	r.faces[size] = face
+	return face
+}
+
+// Layers don't exist in a raster image
+func (r *rasterRenderer) BeginLayer(name string) {}
+
+func (r *rasterRenderer) EndLayer() {}
+
+func (r *rasterRenderer) Polygon(points []Point, style Style) {
+	if style.Fill == nil {
+		return
+	}
+	r.dc.NewSubPath()
+	for _, point := range points {
+		r.dc.LineTo(point.X, point.Y)
+	}
+	r.dc.ClosePath()
+	r.dc.SetColor(style.Fill)
+	r.dc.Fill()
+}
+
+func (r *rasterRenderer) Line(x1 float64, y1 float64, x2 float64, y2 float64, style Style) {
+	if style.Stroke == nil {
+		return
+	}
+	r.dc.SetColor(style.Stroke)
+	r.dc.SetLineWidth(style.LineWidth)
+	r.dc.DrawLine(x1, y1, x2, y2)
+	r.dc.Stroke()
+}
+
+func (r *rasterRenderer) Rectangle(x float64, y float64, width float64, height float64, style Style) {
+	if style.Fill == nil {
+		return
+	}
+	r.dc.DrawRectangle(x, y, width, height)
+	r.dc.SetColor(style.Fill)
+	r.dc.Fill()
+}
+
+// Text at the default label size uses the built-in font of gg, which only has ASCII
+// characters, so maps at the default hex size look the same as before. Other sizes use
+// Go Regular, which scales and has accented characters.
+func (r *rasterRenderer) Text(s string, x float64, y float64, style Style) {
+	if style.Fill == nil {
+		return
+	}
+	if style.FontSize == labelFontSize {
+		s = labelText(s)
+		r.dc.SetFontFace(basicfont.Face7x13)
+		if !style.LeftAligned {
+			x -= 5.0 * float64(len(s)) / 2.0
+		}
+	} else {
+		r.dc.SetFontFace(r.face(style.FontSize))
+		if !style.LeftAligned {
+			width, _ := r.dc.MeasureString(s)
+			x -= width / 2
+		}
+	}
+	r.dc.SetColor(style.Fill)
+	r.dc.DrawString(s, x, y)
+}
@@ -0,0 +1,58 @@
+package graphics
+
+import (
+	"image/color"
+	"math"
+)
+
+// Point is a position in image pixels.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Style describes how a shape is drawn. Backends that can't use a field ignore it.
+type Style struct {
+	// Class names the kind of shape, like "terrain-grass", so vector output can be restyled.
+	// Several classes can be given separated by spaces.
+	Class string
+	// Fill is used for polygons, rectangles and text. Nil means no fill.
+	Fill color.Color
+	// Stroke is used for lines. Nil means no stroke.
+	Stroke    color.Color
+	LineWidth float64
+	FontSize  float64
+	// LeftAligned starts text at x instead of centering it on x
+	LeftAligned bool
+	// Title is a tooltip for viewers that support it
+	Title string
+}
+
+// Renderer is a surface the map is drawn on. The map is drawn in image pixels with the
+// origin in the upper left, and each backend converts them to its own output.
+type Renderer interface {
+	// BeginLayer starts a named group of shapes, which ends with EndLayer
+	BeginLayer(name string)
+	EndLayer()
+	Polygon(points []Point, style Style)
+	Line(x1 float64, y1 float64, x2 float64, y2 float64, style Style)
+	Rectangle(x float64, y float64, width float64, height float64, style Style)
+	// Text draws s centered on x with its baseline at y, unless the style is left aligned
+	Text(s string, x float64, y float64, style Style)
+}
+
+// hexCorners returns the corners of the hex of the given radius centered on (x, y), starting at the upper
+// right corner and going clockwise. The math is the same as gg.DrawRegularPolygon, so
+// raster output doesn't change.
+func hexCorners(x float64, y float64, radius float64) []Point {
+	// The angle is divided at run time like in gg, the constant 2π/6 is rounded differently
+	sides := 6
+	angle := 2 * math.Pi / float64(sides)
+	rotation := -math.Pi/2 + angle/2
+	corners := make([]Point, sides)
+	for i := range corners {
+		a := rotation + angle*float64(i)
+		corners[i] = Point{x + radius*math.Cos(a), y + radius*math.Sin(a)}
+	}
+	return corners
+}
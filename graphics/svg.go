@@ -0,0 +1,149 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func svgColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func svgEscape(s string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(s))
+	return builder.String()
+}
+
+// svgClass converts a terrain or route name to a css class name
+func svgClass(prefix string, name string) string {
+	return prefix + "-" + strings.ReplaceAll(name, "_", "-")
+}
+
+// svgRenderer writes every shape as an SVG element. Shapes with a class get their colors
+// from a style sheet, so the image can be restyled by editing one rule per class.
+type svgRenderer struct {
+	width  int
+	height int
+	body   bytes.Buffer
+	// Rules of the style sheet in the order the classes were first used
+	selectors []string
+	rules     map[string]string
+}
+
+func newSVGRenderer(width int, height int) *svgRenderer {
+	return &svgRenderer{width: width, height: height, rules: make(map[string]string)}
+}
+
+// attributes returns the class or inline style of an element. A shape with several
+// classes gets a rule for all of them together, which takes precedence over the
+// rules for each class.
+func (r *svgRenderer) attributes(style Style, declarations string) string {
+	if style.Class == "" {
+		return fmt.Sprintf(` style="%s"`, declarations)
+	}
+	selector := "." + strings.Join(strings.Fields(style.Class), ".")
+	if _, ok := r.rules[selector]; !ok {
+		r.rules[selector] = declarations
+		r.selectors = append(r.selectors, selector)
+	}
+	return fmt.Sprintf(` class="%s"`, style.Class)
+}
+
+// closeElement ends an element, with the title as a child if there is one.
+func (r *svgRenderer) closeElement(name string, style Style) {
+	if style.Title == "" {
+		r.body.WriteString("/>\n")
+		return
+	}
+	fmt.Fprintf(&r.body, "><title>%s</title></%s>\n", svgEscape(style.Title), name)
+}
+
+func (r *svgRenderer) BeginLayer(name string) {
+	fmt.Fprintf(&r.body, "<g id=\"%s\">\n", svgEscape(name))
+}
+
+func (r *svgRenderer) EndLayer() {
+	r.body.WriteString("</g>\n")
+}
+
+func (r *svgRenderer) Polygon(points []Point, style Style) {
+	if style.Fill == nil {
+		return
+	}
+	coordinates := make([]string, len(points))
+	for i, point := range points {
+		coordinates[i] = svgNumber(point.X) + "," + svgNumber(point.Y)
+	}
+	fmt.Fprintf(&r.body, `<polygon%s points="%s"`, r.attributes(style, "fill: "+svgColor(style.Fill)+";"), strings.Join(coordinates, " "))
+	r.closeElement("polygon", style)
+}
+
+func (r *svgRenderer) Line(x1 float64, y1 float64, x2 float64, y2 float64, style Style) {
+	if style.Stroke == nil {
+		return
+	}
+	declarations := fmt.Sprintf("stroke: %s; stroke-width: %s;", svgColor(style.Stroke), svgNumber(style.LineWidth))
+	fmt.Fprintf(&r.body, `<line%s x1="%s" y1="%s" x2="%s" y2="%s"`, r.attributes(style, declarations),
+		svgNumber(x1), svgNumber(y1), svgNumber(x2), svgNumber(y2))
+	r.closeElement("line", style)
+}
+
+func (r *svgRenderer) Rectangle(x float64, y float64, width float64, height float64, style Style) {
+	if style.Fill == nil {
+		return
+	}
+	fmt.Fprintf(&r.body, `<rect%s x="%s" y="%s" width="%s" height="%s"`, r.attributes(style, "fill: "+svgColor(style.Fill)+";"),
+		svgNumber(x), svgNumber(y), svgNumber(width), svgNumber(height))
+	r.closeElement("rect", style)
+}
+
+func (r *svgRenderer) Text(s string, x float64, y float64, style Style) {
+	if style.Fill == nil {
+		return
+	}
+	anchor := "middle"
+	if style.LeftAligned {
+		anchor = "start"
+	}
+	declarations := fmt.Sprintf("fill: %s; font-family: sans-serif; font-size: %spx; text-anchor: %s;", svgColor(style.Fill), svgNumber(style.FontSize), anchor)
+	fmt.Fprintf(&r.body, "<text%s x=\"%s\" y=\"%s\">%s", r.attributes(style, declarations), svgNumber(x), svgNumber(y), svgEscape(s))
+	if style.Title != "" {
+		fmt.Fprintf(&r.body, "<title>%s</title>", svgEscape(style.Title))
+	}
+	r.body.WriteString("</text>\n")
+}
+
+// WriteTo writes the SVG document with the style sheet before the shapes.
+func (r *svgRenderer) WriteTo(w io.Writer) (int64, error) {
+	var header bytes.Buffer
+	fmt.Fprintf(&header, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		r.width, r.height, r.width, r.height)
+	header.WriteString("<style>\n")
+	for _, selector := range r.selectors {
+		fmt.Fprintf(&header, "%s { %s }\n", selector, r.rules[selector])
+	}
+	header.WriteString("</style>\n")
+
+	n, err := header.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	m, err := r.body.WriteTo(w)
+	if err != nil {
+		return n + m, err
+	}
+	k, err := io.WriteString(w, "</svg>\n")
+	return n + m + int64(k), err
+}
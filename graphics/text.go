@@ -0,0 +1,23 @@
+package graphics
+
+import "strings"
+
+// The default font of gg only has ASCII glyphs, so accented letters are drawn
+// without their accents instead of as boxes.
+var labelReplacer = strings.NewReplacer(
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Æ", "AE", "Ç", "C",
+	"È", "E", "É", "E", "Ê", "E", "Ë", "E", "Ì", "I", "Í", "I", "Î", "I", "Ï", "I",
+	"Ð", "D", "Ñ", "N", "Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U", "Ý", "Y", "Þ", "Th", "ß", "ss",
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae", "ç", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ð", "d", "ñ", "n", "ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "þ", "th", "ÿ", "y",
+	"Š", "S", "š", "s", "Ž", "Z", "ž", "z", "Œ", "OE", "œ", "oe", "Ÿ", "Y", "ƒ", "f",
+	"‘", "'", "’", "'", "‚", "'", "“", "\"", "”", "\"", "„", "\"", "–", "-", "—", "-", "…", "...",
+)
+
+// labelText returns the text that is drawn for a name.
+func labelText(name string) string {
+	return labelReplacer.Replace(name)
+}
@@ -1,26 +1,58 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/samuelyuan/TOAWMap/fileio"
+	"github.com/samuelyuan/TOAWMap/geo"
 	"github.com/samuelyuan/TOAWMap/graphics"
+	"github.com/samuelyuan/TOAWMap/palette"
+	"github.com/samuelyuan/TOAWMap/tiled"
 )
 
-func loadMapDataFromFile(filename string) *fileio.TOAWMapData {
+// loadMapDataFromFile reads the map in any supported format. Terrain grid files are
+// read on top of the base map if one is given.
+func loadMapDataFromFile(ctx context.Context, filename string, baseFilename string) *fileio.TOAWMapData {
 	mapFileExtension := filepath.Ext(filename)
-	if strings.ToLower(mapFileExtension) == ".json" {
+	if strings.ToLower(mapFileExtension) == ".json" || strings.ToLower(mapFileExtension) == ".ndjson" {
 		fmt.Println("Importing map file from json")
-		mapData := fileio.ImportTOAWMapDataFromJson(filename)
+		mapData, err := fileio.ImportTOAWMapDataFromJson(filename)
+		if err != nil {
+			log.Fatal("Failed to import json file: ", err)
+		}
+		return mapData
+	} else if strings.ToLower(mapFileExtension) == ".tmx" {
+		fmt.Println("Importing map file from tmx")
+		mapData, err := tiled.ImportTMX(filename)
+		if err != nil {
+			log.Fatal("Failed to import tmx file: ", err)
+		}
+		return mapData
+	} else if strings.ToLower(mapFileExtension) == ".txt" || strings.ToLower(mapFileExtension) == ".csv" {
+		var base *fileio.TOAWMapData
+		if baseFilename != "" {
+			base = loadMapDataFromFile(ctx, baseFilename, "")
+		}
+		fmt.Println("Importing terrain grid")
+		mapData, err := fileio.ImportTerrainGrid(filename, base)
+		if err != nil {
+			log.Fatal("Failed to import terrain grid: ", err)
+		}
 		return mapData
 	} else {
 		fmt.Println("Reading map from file")
-		mapData, err := fileio.ReadTOAWScenario(filename)
+		opts := fileio.ReadOptions{
+			Warning: func(err error) { fmt.Println("Warning:", err) },
+		}
+		mapData, err := fileio.ReadTOAWScenarioContext(ctx, filename, opts)
 		if err != nil {
 			log.Fatal("Failed to read input file: ", err)
 		}
@@ -28,10 +60,88 @@ func loadMapDataFromFile(filename string) *fileio.TOAWMapData {
 	}
 }
 
+// loadMapData reads the map and renames or adds locations from the gazetteer file if
+// one is given.
+func loadMapData(ctx context.Context, filename string, baseFilename string, gazetteerFilename string) *fileio.TOAWMapData {
+	mapData := loadMapDataFromFile(ctx, filename, baseFilename)
+	if gazetteerFilename != "" {
+		fmt.Println("Importing gazetteer")
+		if err := fileio.ImportGazetteer(gazetteerFilename, mapData); err != nil {
+			log.Fatal("Failed to import gazetteer: ", err)
+		}
+	}
+	return mapData
+}
+
+// loadGeoreference reads the georeference file if there is one, otherwise it is built
+// from the anchor, which has the form "lat,lon".
+func loadGeoreference(georefFilename string, anchor string, hexSizeKm float64, rotation float64) *geo.Georeference {
+	if georefFilename != "" {
+		georef, err := geo.LoadGeoreference(georefFilename)
+		if err != nil {
+			log.Fatal("Failed to load georeference: ", err)
+		}
+		return georef
+	}
+
+	if anchor == "" {
+		fmt.Println("Error: -anchor or -georef is required to place the map")
+		fmt.Println("Use -help for usage information")
+		os.Exit(1)
+	}
+	parts := strings.Split(anchor, ",")
+	if len(parts) != 2 {
+		log.Fatal("Anchor must have the form lat,lon: ", anchor)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		log.Fatal("Invalid anchor latitude: ", parts[0])
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		log.Fatal("Invalid anchor longitude: ", parts[1])
+	}
+	if hexSizeKm <= 0 {
+		log.Fatal("Hex size must be greater than 0: ", hexSizeKm)
+	}
+	return geo.NewGeoreference(lat, lon, hexSizeKm, rotation)
+}
+
+func printResiduals(residuals []geo.Residual) {
+	fmt.Println("Control points:")
+	for _, residual := range residuals {
+		flag := ""
+		if residual.Outlier {
+			flag = " (misplaced)"
+		}
+		fmt.Printf("  %-28s hex %d,%d error %.2f km%s\n", residual.Name, residual.X, residual.Y, residual.ErrorKm, flag)
+	}
+}
+
 func main() {
-	inputPtr := flag.String("input", "", "Input filename (.sce or .json)")
-	outputPtr := flag.String("output", "output.png", "Output filename")
-	modePtr := flag.String("mode", "draw", "Output mode: draw or exportjson")
+	inputPtr := flag.String("input", "", "Input filename (.sce, .json, .ndjson, .tmx, .txt or .csv)")
+	outputPtr := flag.String("output", "output.png", "Output filename, the draw mode writes SVG or PDF if it ends in .svg or .pdf")
+	modePtr := flag.String("mode", "draw", "Output mode: draw, exportjson, exportgeojson, exportkml, exporttmx, exportgrid, exportoob, exportgazetteer, georef or schema")
+	jsonVersionPtr := flag.Int("jsonversion", fileio.JsonSchemaVersion, "Json format version for exportjson (1 or 2)")
+	anchorPtr := flag.String("anchor", "", "Latitude and longitude of the center of hex 0,0 as lat,lon")
+	hexKmPtr := flag.Float64("hexkm", 10, "Distance between neighboring hex centers in km")
+	rotationPtr := flag.Float64("rotation", 0, "Clockwise rotation of the map from north in degrees")
+	georefPtr := flag.String("georef", "", "Georeference json file, used instead of -anchor, -hexkm and -rotation")
+	controlsPtr := flag.String("controls", "", "Csv file with name,lat,lon of map locations, used by the georef mode")
+	geotiffPtr := flag.Bool("geotiff", false, "Also save the drawn map as a GeoTIFF, needs -anchor or -georef")
+	maxErrorPtr := flag.Float64("maxerror", 2, "Distance in hexes after which a control point is flagged as misplaced")
+	basePtr := flag.String("base", "", "Base map for terrain grid input, which keeps its units and locations")
+	gazetteerPtr := flag.String("gazetteer", "", "Csv file with location names to rename or add before the map is used")
+	codePagePtr := flag.String("codepage", string(fileio.CodePageWindows1252), "Code page of the names and messages in the scenario: windows-1252, latin1 or utf-8")
+	paperPtr := flag.String("paper", "", "Print a PDF on pages of this paper size: a4, a3 or letter")
+	hexMmPtr := flag.Float64("hexmm", 8, "Distance between neighboring hex centers on paper in mm, used with -paper")
+	overlapPtr := flag.Float64("overlap", 10, "Width in mm of the map that is printed on both of two neighboring pages, used with -paper")
+	themePtr := flag.String("theme", "game", "Colors of the drawn map: game, print, colorblind, grayscale or a .json theme file")
+	layersPtr := flag.String("layers", "all", "Comma separated layers of the drawn map: terrain, rivers, roads, rails, units and labels, a layer starting with - is left out")
+	legendPtr := flag.Bool("legend", false, "Add a margin below the drawn map with the title, sides, legend and a scale bar")
+	radiusPtr := flag.Float64("radius", 10, "Hex radius in pixels of the drawn map, ignored if -width or -height is set")
+	widthPtr := flag.Int("width", 0, "Largest width of the drawn map in pixels, the hex radius is chosen to fit")
+	heightPtr := flag.Int("height", 0, "Largest height of the drawn map in pixels, the hex radius is chosen to fit")
 	helpPtr := flag.Bool("help", false, "Show help information")
 	flag.Parse()
 
@@ -41,6 +151,26 @@ func main() {
 		return
 	}
 
+	// The schema doesn't depend on any input
+	if *modePtr == "schema" {
+		schema, err := fileio.JsonSchema()
+		if err != nil {
+			log.Fatal("Failed to generate json schema: ", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
+	if err := fileio.SetCodePage(*codePagePtr); err != nil {
+		log.Fatal(err)
+	}
+	if err := palette.SetTheme(*themePtr); err != nil {
+		log.Fatal(err)
+	}
+	if *jsonVersionPtr != 1 && *jsonVersionPtr != 2 {
+		log.Fatalf("unknown json version %d, expected 1 or 2", *jsonVersionPtr)
+	}
+
 	// Validate required input
 	if *inputPtr == "" {
 		fmt.Println("Error: Input filename is required")
@@ -50,26 +180,119 @@ func main() {
 
 	inputFilename := *inputPtr
 	outputFilename := *outputPtr
+
+	// Stop loading if the user presses Ctrl+C. Only loading checks ctx, so Ctrl+C
+	// goes back to ending the program right away once the map is loaded.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	loadMap := func() *fileio.TOAWMapData {
+		mapData := loadMapData(ctx, inputFilename, *basePtr, *gazetteerPtr)
+		stop()
+		return mapData
+	}
 	
 	fmt.Printf("TOAWMap - Processing: %s\n", inputFilename)
 	fmt.Printf("Output: %s\n", outputFilename)
 
 	mode := *modePtr
 	if mode == "draw" {
+		drawOptions := graphics.DrawOptions{GeoTIFF: *geotiffPtr, Radius: *radiusPtr, Width: *widthPtr, Height: *heightPtr}
+		layers, err := graphics.ParseLayers(*layersPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		drawOptions.Layers = layers
+		drawOptions.Legend = *legendPtr
+		// The default hex size is only a guess, so the scale bar only shows km if it is given
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "hexkm" {
+				drawOptions.HexSizeKm = *hexKmPtr
+			}
+		})
+		if *paperPtr != "" {
+			drawOptions.Print = &graphics.PrintOptions{Paper: *paperPtr, HexSizeMm: *hexMmPtr, OverlapMm: *overlapPtr}
+		}
+		if *georefPtr != "" || *anchorPtr != "" || *geotiffPtr {
+			drawOptions.Georeference = loadGeoreference(*georefPtr, *anchorPtr, *hexKmPtr, *rotationPtr)
+		}
 		fmt.Println("Reading map data...")
-		mapData := loadMapDataFromFile(inputFilename)
+		mapData := loadMap()
 		fmt.Println("Generating map image...")
-		graphics.DrawMap(mapData, outputFilename)
+		graphics.DrawMapWithOptions(mapData, outputFilename, drawOptions)
 		fmt.Printf("Map saved to %s\n", outputFilename)
 	} else if mode == "exportjson" {
 		fmt.Println("Reading map data...")
-		mapData := loadMapDataFromFile(inputFilename)
+		mapData := loadMap()
 		fmt.Printf("Exporting map to %s...\n", outputFilename)
-		fileio.ExportTOAWMapJson(mapData, outputFilename)
+		if *jsonVersionPtr == 1 {
+			fileio.ExportTOAWMapJsonLegacy(mapData, outputFilename)
+		} else {
+			fileio.ExportTOAWMapJson(mapData, outputFilename)
+		}
 		fmt.Printf("Map exported to %s\n", outputFilename)
+	} else if mode == "exportgeojson" {
+		georef := loadGeoreference(*georefPtr, *anchorPtr, *hexKmPtr, *rotationPtr)
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		fmt.Printf("Exporting map to %s...\n", outputFilename)
+		geo.ExportGeoJSON(mapData, georef, outputFilename)
+		fmt.Printf("Map exported to %s\n", outputFilename)
+	} else if mode == "exportkml" {
+		georef := loadGeoreference(*georefPtr, *anchorPtr, *hexKmPtr, *rotationPtr)
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		fmt.Printf("Exporting map to %s...\n", outputFilename)
+		geo.ExportKML(mapData, georef, outputFilename)
+		fmt.Printf("Map exported to %s\n", outputFilename)
+	} else if mode == "exportoob" {
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		fmt.Printf("Exporting order of battle to %s...\n", outputFilename)
+		fileio.ExportOrderOfBattle(mapData, outputFilename)
+		fmt.Printf("Order of battle exported to %s\n", outputFilename)
+	} else if mode == "exportgazetteer" {
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		fmt.Printf("Exporting gazetteer to %s...\n", outputFilename)
+		fileio.ExportGazetteer(mapData, outputFilename)
+		fmt.Printf("Gazetteer exported to %s\n", outputFilename)
+	} else if mode == "exportgrid" {
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		fmt.Printf("Exporting terrain grid to %s...\n", outputFilename)
+		fileio.ExportTerrainGrid(mapData, outputFilename)
+		fmt.Printf("Terrain grid exported to %s\n", outputFilename)
+	} else if mode == "exporttmx" {
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		fmt.Printf("Exporting map to %s...\n", outputFilename)
+		tiled.ExportTMX(mapData, outputFilename)
+		fmt.Printf("Map exported to %s and %s\n", outputFilename, tiled.TilesetFilename(outputFilename))
+	} else if mode == "georef" {
+		if *controlsPtr == "" {
+			fmt.Println("Error: -controls is required for the georef mode")
+			fmt.Println("Use -help for usage information")
+			os.Exit(1)
+		}
+		controlPoints, err := geo.LoadControlPoints(*controlsPtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Reading map data...")
+		mapData := loadMap()
+		georef, residuals, err := geo.Calibrate(mapData, controlPoints, *maxErrorPtr)
+		if err != nil {
+			log.Fatal("Failed to fit georeference: ", err)
+		}
+		printResiduals(residuals)
+		fmt.Printf("Hex size: %.2f km\n", georef.HexSizeKm)
+		if err := georef.Save(outputFilename); err != nil {
+			log.Fatal("Error writing to ", outputFilename, ": ", err)
+		}
+		fmt.Printf("Georeference saved to %s\n", outputFilename)
 	} else {
 		fmt.Printf("Error: Invalid mode '%s'\n", mode)
-		fmt.Println("Valid modes: draw, exportjson")
+		fmt.Println("Valid modes: draw, exportjson, exportgeojson, exportkml, exporttmx, exportgrid, exportoob, exportgazetteer, georef, schema")
 		fmt.Println("Use -help for more information")
 		os.Exit(1)
 	}
@@ -83,18 +306,85 @@ func showHelp() {
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -input string")
-	fmt.Println("        Input filename (.sce or .json) (required)")
+	fmt.Println("        Input filename (.sce, .json, .ndjson, .tmx, .txt or .csv) (required)")
 	fmt.Println("  -output string")
 	fmt.Println("        Output filename (default: output.png)")
+	fmt.Println("        The draw mode writes an SVG or PDF image if the output ends in .svg or .pdf")
 	fmt.Println("  -mode string")
-	fmt.Println("        Output mode: draw or exportjson (default: draw)")
+	fmt.Println("        Output mode: draw, exportjson, exportgeojson, exportkml, exporttmx, exportgrid, exportoob, exportgazetteer, georef or schema (default: draw)")
+	fmt.Println("        exportoob writes the units as csv if the output ends in .csv, json otherwise")
+	fmt.Println("        exportgazetteer writes the named locations as csv")
+	fmt.Println("        georef fits a georeference to the -controls file and saves it to the output file")
+	fmt.Println("        schema prints the JSON Schema of the exportjson format and needs no input")
+	fmt.Println("  -jsonversion int")
+	fmt.Println("        Json format version for exportjson, 1 for the original format (default: 2)")
+	fmt.Println("  -anchor string")
+	fmt.Println("        Latitude and longitude of the center of hex 0,0 as lat,lon, used by exportgeojson and exportkml")
+	fmt.Println("        When drawing, a world file is written next to the image")
+	fmt.Println("  -hexkm float")
+	fmt.Println("        Distance between neighboring hex centers in km (default: 10)")
+	fmt.Println("  -rotation float")
+	fmt.Println("        Clockwise rotation of the map from north in degrees (default: 0)")
+	fmt.Println("  -georef string")
+	fmt.Println("        Georeference json file, used instead of -anchor, -hexkm and -rotation")
+	fmt.Println("  -geotiff")
+	fmt.Println("        Also save the drawn map as a GeoTIFF, needs -anchor or -georef")
+	fmt.Println("  -controls string")
+	fmt.Println("        Csv file with name,lat,lon of map locations, used by the georef mode")
+	fmt.Println("  -maxerror float")
+	fmt.Println("        Distance in hexes after which a control point is flagged as misplaced (default: 2)")
+	fmt.Println("  -base string")
+	fmt.Println("        Base map for terrain grid input (.txt or .csv), which keeps its units and locations")
+	fmt.Println("  -gazetteer string")
+	fmt.Println("        Csv file with index,name,x,y of locations to rename or add before the map is used")
+	fmt.Println("  -codepage string")
+	fmt.Println("        Code page of the names and messages in the scenario: windows-1252, latin1 or utf-8 (default: windows-1252)")
+	fmt.Println("  -theme string")
+	fmt.Println("        Colors of the drawn map: game, print, colorblind, grayscale or a .json theme file (default: game)")
+	fmt.Println("  -layers string")
+	fmt.Println("        Comma separated layers to draw: terrain, rivers, roads, rails, units and labels (default: all)")
+	fmt.Println("        A layer starting with - is left out, so -layers=-units draws everything but the units")
+	fmt.Println("  -legend")
+	fmt.Println("        Add a margin below the drawn map with the title, sides, legend and a scale bar in hexes,")
+	fmt.Println("        and in km if -hexkm, -anchor or -georef is given")
+	fmt.Println("  -radius float")
+	fmt.Println("        Hex radius in pixels of the drawn map, labels and units are scaled with it (default: 10)")
+	fmt.Println("  -width int")
+	fmt.Println("        Largest width of the drawn map in pixels, the hex radius is chosen to fit")
+	fmt.Println("  -height int")
+	fmt.Println("        Largest height of the drawn map in pixels, the hex radius is chosen to fit")
+	fmt.Println("  -paper string")
+	fmt.Println("        Print a PDF on pages of a4, a3 or letter paper, with a cover page that has the title, page index and legend")
+	fmt.Println("  -hexmm float")
+	fmt.Println("        Distance between neighboring hex centers on paper in mm, used with -paper (default: 8)")
+	fmt.Println("  -overlap float")
+	fmt.Println("        Width in mm of the map printed on both of two neighboring pages, used with -paper (default: 10)")
 	fmt.Println("  -help")
 	fmt.Println("        Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  TOAWMap -input=scenario.sce -output=map.png")
 	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportjson -output=data.json")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportjson -output=data.ndjson")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportgeojson -anchor=52.2,21.0 -hexkm=10 -output=map.geojson")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportkml -georef=georef.json -output=map.kml")
+	fmt.Println("  TOAWMap -input=scenario.sce -georef=georef.json -geotiff -output=map.png")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=georef -controls=cities.csv -output=georef.json")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exporttmx -output=map.tmx")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=scenario.svg")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=scenario.pdf")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=scenario.pdf -paper=a4 -hexmm=8")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=scenario.png -width=2000")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=scenario.png -theme=colorblind")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=logistics.png -layers=terrain,rails")
+	fmt.Println("  TOAWMap -input=scenario.sce -output=scenario.png -legend -hexkm=10")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportoob -output=units.csv")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportgazetteer -output=places.csv")
+	fmt.Println("  TOAWMap -input=scenario.sce -gazetteer=places.csv -mode=exportjson -output=renamed.json")
+	fmt.Println("  TOAWMap -input=scenario.sce -mode=exportgrid -output=terrain.txt")
+	fmt.Println("  TOAWMap -input=terrain.txt -base=scenario.sce -mode=exportjson -output=edited.json")
 	fmt.Println("  TOAWMap -input=map.json -output=rendered.png")
+	fmt.Println("  TOAWMap -mode=schema > toawmap.schema.json")
 	fmt.Println()
 	fmt.Println("Supported games:")
 	fmt.Println("  - The Operational Art of War: Century of Warfare")
@@ -0,0 +1,103 @@
+/*
+Package palette has the colors used to draw maps, so every output format looks the same.
+*/
+package palette
+
+import (
+	"image/color"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+var (
+	// EmptyColor is used for tiles outside the playable area
+	EmptyColor = color.RGBA{0, 0, 0, 255}
+	// ForestColor is drawn instead of the base terrain of land tiles with a forest
+	ForestColor = color.RGBA{78, 116, 53, 255}
+	// UrbanColor is used for the marker on urban tiles
+	UrbanColor = color.RGBA{255, 255, 255, 255}
+	// LocationColor is used for location names
+	LocationColor = color.RGBA{255, 255, 255, 255}
+)
+
+// TerrainColors has the fill color of each base terrain.
+var TerrainColors = map[fileio.Terrain]color.RGBA{
+	fileio.TerrainEmpty:        EmptyColor,
+	fileio.TerrainImpassable:   {67, 65, 68, 255},
+	fileio.TerrainDeepWater:    {21, 43, 116, 255},
+	fileio.TerrainShallowWater: {64, 93, 166, 255},
+	fileio.TerrainMountains:    {169, 154, 133, 255},
+	fileio.TerrainHills:        {149, 132, 58, 255},
+	fileio.TerrainSand:         {189, 159, 86, 255},
+	fileio.TerrainFloodedMarsh: {137, 172, 139, 255},
+	fileio.TerrainMarsh:        {122, 148, 71, 255},
+	fileio.TerrainGrass:        {146, 155, 59, 255},
+}
+
+// FeatureColors has colors for terrain subtypes, which are drawn in the color of their
+// terrain, forest or urban marker when they have none. The game theme has none.
+var FeatureColors = map[fileio.Feature]color.RGBA{}
+
+// RouteColors has the line color of each route. Dry rivers aren't drawn on the rendered map.
+var RouteColors = map[fileio.Route]color.RGBA{
+	fileio.RouteDryRiver:   {160, 178, 186, 255},
+	fileio.RouteRiver:      {91, 130, 150, 255},
+	fileio.RouteMajorRiver: {57, 82, 148, 255},
+	fileio.RouteRoad:       {195, 167, 87, 255},
+	fileio.RouteRailroad:   {102, 91, 72, 255},
+}
+
+// ShowsForest reports whether a tile is filled with the forest color.
+// Forests aren't shown on impassable tiles or water.
+func ShowsForest(tileData fileio.TileData) bool {
+	switch tileData.Terrain() {
+	case fileio.TerrainEmpty, fileio.TerrainImpassable, fileio.TerrainDeepWater, fileio.TerrainShallowWater:
+		return false
+	}
+	return tileData.IsForest()
+}
+
+// TileFeature returns the terrain subtype of a tile that has a color in FeatureColors.
+// Forest subtypes are only used where the forest is shown, and the other land subtypes
+// only on sand, which they make the terrain of the tile.
+func TileFeature(tileData fileio.TileData) (fileio.Feature, bool) {
+	showsForest := ShowsForest(tileData)
+	for _, feature := range tileData.Features() {
+		if _, ok := FeatureColors[feature]; !ok || feature.IsUrban() {
+			continue
+		}
+		if feature.IsForest() == showsForest && (showsForest || tileData.Terrain() == fileio.TerrainSand) {
+			return feature, true
+		}
+	}
+	return "", false
+}
+
+// TileColor returns the fill color of a tile.
+func TileColor(tileData fileio.TileData) color.RGBA {
+	if feature, ok := TileFeature(tileData); ok {
+		return FeatureColors[feature]
+	}
+	if ShowsForest(tileData) {
+		return ForestColor
+	}
+	return TerrainColors[tileData.Terrain()]
+}
+
+// UrbanFeature returns the urban subtype of a tile that has a color in FeatureColors.
+func UrbanFeature(tileData fileio.TileData) (fileio.Feature, bool) {
+	for _, feature := range tileData.Features() {
+		if _, ok := FeatureColors[feature]; ok && feature.IsUrban() {
+			return feature, true
+		}
+	}
+	return "", false
+}
+
+// UrbanMarkerColor returns the color of the marker on an urban tile.
+func UrbanMarkerColor(tileData fileio.TileData) color.RGBA {
+	if feature, ok := UrbanFeature(tileData); ok {
+		return FeatureColors[feature]
+	}
+	return UrbanColor
+}
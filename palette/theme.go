@@ -0,0 +1,325 @@
+package palette
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// Theme is a complete set of colors to draw maps with.
+type Theme struct {
+	Terrain map[fileio.Terrain]color.RGBA
+	// Features has colors for terrain subtypes. A subtype without a color is drawn
+	// in the color of its terrain, or the forest or urban color.
+	Features map[fileio.Feature]color.RGBA
+	Forest   color.RGBA
+	Urban    color.RGBA
+	Label    color.RGBA
+	Routes   map[fileio.Route]color.RGBA
+	Groups   map[int]GroupColor
+}
+
+// currentTheme returns a copy of the colors in use.
+func currentTheme() Theme {
+	return Theme{
+		Terrain:  TerrainColors,
+		Features: FeatureColors,
+		Forest:   ForestColor,
+		Urban:    UrbanColor,
+		Label:    LocationColor,
+		Routes:   RouteColors,
+		Groups:   groupColors,
+	}.clone()
+}
+
+// clone copies the maps of the theme, so changing the copy doesn't change the theme.
+func (t Theme) clone() Theme {
+	theme := t
+	theme.Terrain = make(map[fileio.Terrain]color.RGBA)
+	for terrain, c := range t.Terrain {
+		theme.Terrain[terrain] = c
+	}
+	theme.Features = make(map[fileio.Feature]color.RGBA)
+	for feature, c := range t.Features {
+		theme.Features[feature] = c
+	}
+	theme.Routes = make(map[fileio.Route]color.RGBA)
+	for route, c := range t.Routes {
+		theme.Routes[route] = c
+	}
+	theme.Groups = make(map[int]GroupColor)
+	for group, c := range t.Groups {
+		theme.Groups[group] = c
+	}
+	return theme
+}
+
+// gameTheme has the colors of the game, which are the defaults of the package variables
+var gameTheme = currentTheme()
+
+func printTheme() Theme {
+	theme := gameTheme.clone()
+	theme.Terrain = map[fileio.Terrain]color.RGBA{
+		fileio.TerrainEmpty:        {255, 255, 255, 255},
+		fileio.TerrainImpassable:   {120, 120, 120, 255},
+		fileio.TerrainDeepWater:    {150, 190, 225, 255},
+		fileio.TerrainShallowWater: {200, 225, 245, 255},
+		fileio.TerrainMountains:    {205, 185, 160, 255},
+		fileio.TerrainHills:        {225, 215, 170, 255},
+		fileio.TerrainSand:         {245, 235, 195, 255},
+		fileio.TerrainFloodedMarsh: {190, 220, 210, 255},
+		fileio.TerrainMarsh:        {210, 230, 190, 255},
+		fileio.TerrainGrass:        {240, 245, 225, 255},
+	}
+	theme.Forest = color.RGBA{185, 215, 160, 255}
+	theme.Urban = color.RGBA{90, 90, 90, 255}
+	theme.Label = color.RGBA{0, 0, 0, 255}
+	theme.Routes = map[fileio.Route]color.RGBA{
+		fileio.RouteDryRiver:   {170, 200, 225, 255},
+		fileio.RouteRiver:      {60, 120, 200, 255},
+		fileio.RouteMajorRiver: {30, 70, 170, 255},
+		fileio.RouteRoad:       {180, 60, 40, 255},
+		fileio.RouteRailroad:   {40, 40, 40, 255},
+	}
+	return theme
+}
+
+// colorBlindTheme uses the Okabe-Ito colors, which can be told apart with every
+// common kind of color blindness. The unit colors are the ones of the game.
+func colorBlindTheme() Theme {
+	theme := gameTheme.clone()
+	theme.Terrain = map[fileio.Terrain]color.RGBA{
+		fileio.TerrainEmpty:        {0, 0, 0, 255},
+		fileio.TerrainImpassable:   {60, 60, 60, 255},
+		fileio.TerrainDeepWater:    {0, 114, 178, 255},
+		fileio.TerrainShallowWater: {86, 180, 233, 255},
+		fileio.TerrainMountains:    {170, 120, 100, 255},
+		fileio.TerrainHills:        {230, 159, 0, 255},
+		fileio.TerrainSand:         {240, 228, 66, 255},
+		fileio.TerrainFloodedMarsh: {204, 121, 167, 255},
+		fileio.TerrainMarsh:        {0, 158, 115, 255},
+		fileio.TerrainGrass:        {200, 210, 170, 255},
+	}
+	theme.Forest = color.RGBA{0, 90, 60, 255}
+	theme.Urban = color.RGBA{0, 0, 0, 255}
+	theme.Label = color.RGBA{0, 0, 0, 255}
+	theme.Routes = map[fileio.Route]color.RGBA{
+		fileio.RouteDryRiver:   {160, 200, 230, 255},
+		fileio.RouteRiver:      {0, 114, 178, 255},
+		fileio.RouteMajorRiver: {0, 60, 130, 255},
+		fileio.RouteRoad:       {213, 94, 0, 255},
+		fileio.RouteRailroad:   {80, 80, 80, 255},
+	}
+	return theme
+}
+
+func gray(c color.RGBA) color.RGBA {
+	y := uint8(0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B) + 0.5)
+	return color.RGBA{y, y, y, c.A}
+}
+
+// grayscaleTheme is the game theme in shades of gray, by the brightness of each color.
+func grayscaleTheme() Theme {
+	theme := gameTheme.clone()
+	for terrain, c := range theme.Terrain {
+		theme.Terrain[terrain] = gray(c)
+	}
+	for feature, c := range theme.Features {
+		theme.Features[feature] = gray(c)
+	}
+	for route, c := range theme.Routes {
+		theme.Routes[route] = gray(c)
+	}
+	for group, c := range theme.Groups {
+		theme.Groups[group] = GroupColor{OuterColor: gray(c.OuterColor), InnerColor: gray(c.InnerColor)}
+	}
+	theme.Forest, theme.Urban, theme.Label = gray(theme.Forest), gray(theme.Urban), gray(theme.Label)
+	return theme
+}
+
+// BuiltinThemes has the themes that can be used by name. Each call returns a new copy
+// that can be changed.
+var BuiltinThemes = map[string]func() Theme{
+	"game":       gameTheme.clone,
+	"print":      printTheme,
+	"colorblind": colorBlindTheme,
+	"grayscale":  grayscaleTheme,
+}
+
+// builtinThemeNames returns the names of the built-in themes in alphabetical order.
+func builtinThemeNames() []string {
+	names := make([]string, 0, len(BuiltinThemes))
+	for name := range BuiltinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// themeFile is the json format of a theme. Colors are written as #rrggbb and
+// anything that is left out is taken from the base theme.
+type themeFile struct {
+	Base     string                    `json:"base"`
+	Terrain  map[string]string         `json:"terrain"`
+	Features map[string]string         `json:"features"`
+	Forest   string                    `json:"forest"`
+	Urban    string                    `json:"urban"`
+	Label    string                    `json:"label"`
+	Routes   map[string]string         `json:"routes"`
+	Groups   map[string]themeGroupFile `json:"groups"`
+}
+
+type themeGroupFile struct {
+	Outer string `json:"outer"`
+	Inner string `json:"inner"`
+}
+
+// parseColor reads a color written as #rrggbb.
+func parseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}, nil
+}
+
+// setColor replaces a color of the theme if the file has one.
+func setColor(target *color.RGBA, s string, name string) error {
+	if s == "" {
+		return nil
+	}
+	c, err := parseColor(s)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	*target = c
+	return nil
+}
+
+// LoadThemeFile reads a json theme.
+func LoadThemeFile(filename string) (Theme, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Theme{}, err
+	}
+	var file themeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Theme{}, fmt.Errorf("failed to parse theme %s: %v", filename, err)
+	}
+
+	base := file.Base
+	if base == "" {
+		base = "game"
+	}
+	builtin, ok := BuiltinThemes[base]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown base theme %s, expected one of %v", base, builtinThemeNames())
+	}
+	theme := builtin()
+
+	for name, s := range file.Terrain {
+		if !isKnown(fileio.AllTerrains, fileio.Terrain(name)) {
+			return Theme{}, fmt.Errorf("unknown terrain %s in theme", name)
+		}
+		c := theme.Terrain[fileio.Terrain(name)]
+		if err := setColor(&c, s, "terrain "+name); err != nil {
+			return Theme{}, err
+		}
+		theme.Terrain[fileio.Terrain(name)] = c
+	}
+	for name, s := range file.Features {
+		if !isKnown(fileio.AllFeatures, fileio.Feature(name)) {
+			return Theme{}, fmt.Errorf("unknown terrain subtype %s in theme", name)
+		}
+		// Features only have a color if the theme gives them one, so an empty value
+		// keeps the color of the base theme or leaves the feature without one
+		if s == "" {
+			continue
+		}
+		var c color.RGBA
+		if err := setColor(&c, s, "feature "+name); err != nil {
+			return Theme{}, err
+		}
+		theme.Features[fileio.Feature(name)] = c
+	}
+	for name, s := range file.Routes {
+		if !isKnown(fileio.AllRoutes, fileio.Route(name)) {
+			return Theme{}, fmt.Errorf("unknown route %s in theme", name)
+		}
+		c := theme.Routes[fileio.Route(name)]
+		if err := setColor(&c, s, "route "+name); err != nil {
+			return Theme{}, err
+		}
+		theme.Routes[fileio.Route(name)] = c
+	}
+	for name, g := range file.Groups {
+		group, err := strconv.Atoi(name)
+		if err != nil || group < 0 {
+			return Theme{}, fmt.Errorf("invalid color group %s in theme", name)
+		}
+		groupColor := theme.Groups[group]
+		if err := setColor(&groupColor.OuterColor, g.Outer, "group "+name+" outer"); err != nil {
+			return Theme{}, err
+		}
+		if err := setColor(&groupColor.InnerColor, g.Inner, "group "+name+" inner"); err != nil {
+			return Theme{}, err
+		}
+		theme.Groups[group] = groupColor
+	}
+	if err := setColor(&theme.Forest, file.Forest, "forest"); err != nil {
+		return Theme{}, err
+	}
+	if err := setColor(&theme.Urban, file.Urban, "urban"); err != nil {
+		return Theme{}, err
+	}
+	if err := setColor(&theme.Label, file.Label, "label"); err != nil {
+		return Theme{}, err
+	}
+	return theme, nil
+}
+
+func isKnown[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// UseTheme makes the theme the colors every map is drawn with.
+func UseTheme(theme Theme) {
+	TerrainColors = theme.Terrain
+	EmptyColor = theme.Terrain[fileio.TerrainEmpty]
+	FeatureColors = theme.Features
+	ForestColor = theme.Forest
+	UrbanColor = theme.Urban
+	LocationColor = theme.Label
+	RouteColors = theme.Routes
+	groupColors = theme.Groups
+}
+
+// SetTheme uses a built-in theme by name, or a theme from a json file. The game
+// theme is used by default.
+func SetTheme(name string) error {
+	if builtin, ok := BuiltinThemes[strings.ToLower(name)]; ok {
+		UseTheme(builtin())
+		return nil
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".json") {
+		return fmt.Errorf("unknown theme %s, expected one of %v or a .json file", name, builtinThemeNames())
+	}
+	theme, err := LoadThemeFile(name)
+	if err != nil {
+		return err
+	}
+	UseTheme(theme)
+	return nil
+}
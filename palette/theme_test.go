@@ -0,0 +1,38 @@
+package palette
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// An empty color in a theme file keeps the color of the base theme, for features too.
+func TestLoadThemeFileEmptyFeature(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "theme.json")
+	data := `{"features": {"c_forest": "", "urban1": "", "urban2": "#ff0000"}, "forest": ""}`
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	theme, err := LoadThemeFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := BuiltinThemes["game"]()
+	for _, feature := range []fileio.Feature{fileio.FeatureCForest, fileio.FeatureUrban1} {
+		c, ok := theme.Features[feature]
+		baseColor, baseOk := base.Features[feature]
+		if ok != baseOk || c != baseColor {
+			t.Errorf("feature %s is %v (set %v), expected %v (set %v) from the base theme", feature, c, ok, baseColor, baseOk)
+		}
+	}
+	if c := theme.Features[fileio.FeatureUrban2]; c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("feature urban2 is %v, expected red", c)
+	}
+	if theme.Forest != base.Forest {
+		t.Errorf("forest is %v, expected %v from the base theme", theme.Forest, base.Forest)
+	}
+}
@@ -0,0 +1,249 @@
+package tiled
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/samuelyuan/TOAWMap/fileio"
+	"github.com/samuelyuan/TOAWMap/palette"
+)
+
+// TilesetFilename returns the name of the tileset image written next to a TMX file.
+func TilesetFilename(tmxFilename string) string {
+	return strings.TrimSuffix(tmxFilename, filepath.Ext(tmxFilename)) + "_terrain.png"
+}
+
+// SaveTileset draws one hex for each terrain, in the order of fileio.AllTerrains.
+func SaveTileset(filename string) error {
+	dc := gg.NewContext(tileWidth*len(fileio.AllTerrains), tileHeight)
+	for i, terrain := range fileio.AllTerrains {
+		dc.DrawRegularPolygon(6, float64(i*tileWidth)+tileWidth/2, tileHeight/2, hexSideLength, 0)
+		dc.SetColor(palette.TerrainColors[terrain])
+		dc.Fill()
+	}
+	return dc.SavePNG(filename)
+}
+
+func newTileset(imageSource string) tmxTileset {
+	tileset := tmxTileset{
+		FirstGid:   1,
+		Name:       terrainLayerName,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+		TileCount:  len(fileio.AllTerrains),
+		Columns:    len(fileio.AllTerrains),
+		Image: tmxImage{
+			Source: imageSource,
+			Width:  tileWidth * len(fileio.AllTerrains),
+			Height: tileHeight,
+		},
+	}
+	for i, terrain := range fileio.AllTerrains {
+		tileset.Tiles = append(tileset.Tiles, tmxTile{
+			Id:         i,
+			Properties: []tmxProperty{{Name: terrainProperty, Value: string(terrain)}},
+		})
+	}
+	return tileset
+}
+
+func intProperty(name string, value int) tmxProperty {
+	return tmxProperty{Name: name, Type: "int", Value: strconv.Itoa(value)}
+}
+
+func jsonProperty(name string, value interface{}) (tmxProperty, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return tmxProperty{}, err
+	}
+	return tmxProperty{Name: name, Value: string(data)}, nil
+}
+
+// compressTiles stores the raw tile records, so everything the terrain layer doesn't show
+// survives a round trip through Tiled.
+func compressTiles(allTileData *fileio.TileGrid) (string, error) {
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	if _, err := writer.Write(allTileData.Bytes()); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+func terrainLayerData(allTileData *fileio.TileGrid) string {
+	gids := make(map[fileio.Terrain]int)
+	for i, terrain := range fileio.AllTerrains {
+		gids[terrain] = i + 1
+	}
+
+	var builder strings.Builder
+	builder.WriteString("\n")
+	for y := 0; y < allTileData.Height(); y++ {
+		for x := 0; x < allTileData.Width(); x++ {
+			builder.WriteString(strconv.Itoa(gids[allTileData.At(x, y).Terrain()]))
+			if x < allTileData.Width()-1 || y < allTileData.Height()-1 {
+				builder.WriteString(",")
+			}
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+func unitObject(id int, unitJson fileio.UnitJson) tmxObject {
+	object := tmxObject{
+		Id:   id,
+		Name: unitJson.Name,
+		Type: "unit",
+		Properties: []tmxProperty{
+			intProperty(indexProperty, unitJson.Index),
+			intProperty(colorGroupProperty, unitJson.ColorGroup),
+			intProperty(unitTypeProperty, unitJson.Type),
+			intProperty(proficiencyProperty, int(unitJson.Proficiency)),
+			intProperty(readinessProperty, int(unitJson.Readiness)),
+			intProperty(supplyLevelProperty, int(unitJson.SupplyLevel)),
+		},
+		Point: &struct{}{},
+	}
+	if unitJson.NextUnitOnSameTile != nil {
+		object.Properties = append(object.Properties, intProperty(nextUnitProperty, *unitJson.NextUnitOnSameTile))
+	}
+	if unitJson.X != nil && unitJson.Y != nil {
+		object.X, object.Y = hexPosition(*unitJson.X, *unitJson.Y)
+	}
+	return object
+}
+
+func newTmxMap(mapData *fileio.TOAWMapData, tilesetSource string) (*tmxMap, error) {
+	mapJson := fileio.NewTOAWMapJsonV2WithoutTiles(mapData)
+	if mapData.AllTileData == nil {
+		return nil, fmt.Errorf("the map has no tile data")
+	}
+
+	tiles, err := compressTiles(mapData.AllTileData)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := jsonProperty(metadataProperty, mapJson.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := jsonProperty(teamsProperty, mapJson.Teams)
+	if err != nil {
+		return nil, err
+	}
+
+	tmx := &tmxMap{
+		Version:       "1.10",
+		Orientation:   "hexagonal",
+		RenderOrder:   "right-down",
+		Width:         mapData.MapWidth,
+		Height:        mapData.MapHeight,
+		TileWidth:     tileWidth,
+		TileHeight:    tileHeight,
+		HexSideLength: hexSideLength,
+		StaggerAxis:   "x",
+		StaggerIndex:  "even",
+		Properties: []tmxProperty{
+			intProperty(versionProperty, mapData.Version),
+			intProperty(tileSizeProperty, mapData.AllTileData.TileSize()),
+			intProperty(locationSlotsProperty, mapJson.Map.LocationSlots),
+			intProperty(unitSlotsProperty, mapJson.Map.UnitSlots),
+			metadata,
+			teams,
+			{Name: tilesProperty, Value: tiles},
+		},
+		Tilesets: []tmxTileset{newTileset(tilesetSource)},
+		Layers: []tmxLayer{{
+			Id:     1,
+			Name:   terrainLayerName,
+			Width:  mapData.MapWidth,
+			Height: mapData.MapHeight,
+			Data:   tmxData{Encoding: "csv", Text: terrainLayerData(mapData.AllTileData)},
+		}},
+	}
+
+	nextObjectId := 1
+	locations := tmxObjectGroup{Id: 2, Name: locationsLayerName}
+	for _, locationJson := range mapJson.Locations {
+		x, y := hexPosition(locationJson.X, locationJson.Y)
+		locations.Objects = append(locations.Objects, tmxObject{
+			Id:         nextObjectId,
+			Name:       locationJson.Name,
+			Type:       "location",
+			X:          x,
+			Y:          y,
+			Properties: []tmxProperty{intProperty(indexProperty, locationJson.Index)},
+			Point:      &struct{}{},
+		})
+		nextObjectId++
+	}
+
+	hidden := 0
+	units := tmxObjectGroup{Id: 3, Name: unitsLayerName}
+	offMapUnits := tmxObjectGroup{Id: 4, Name: offMapUnitsLayerName, Visible: &hidden}
+	for _, unitJson := range mapJson.Units {
+		object := unitObject(nextObjectId, unitJson)
+		if unitJson.X != nil && unitJson.Y != nil {
+			units.Objects = append(units.Objects, object)
+		} else {
+			offMapUnits.Objects = append(offMapUnits.Objects, object)
+		}
+		nextObjectId++
+	}
+
+	tmx.ObjectGroups = []tmxObjectGroup{locations, units, offMapUnits}
+	tmx.NextLayerId = 5
+	tmx.NextObjectId = nextObjectId
+	return tmx, nil
+}
+
+// WriteTMX writes the map as a TMX file that uses the tileset image at tilesetSource.
+func WriteTMX(w io.Writer, mapData *fileio.TOAWMapData, tilesetSource string) error {
+	tmx, err := newTmxMap(mapData, tilesetSource)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", " ")
+	if err := encoder.Encode(tmx); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// ExportTMX writes the map to a TMX file and the terrain tileset image next to it.
+func ExportTMX(mapData *fileio.TOAWMapData, outputFilename string) {
+	tilesetFilename := TilesetFilename(outputFilename)
+	if err := SaveTileset(tilesetFilename); err != nil {
+		log.Fatal("Failed to save tileset: ", err)
+	}
+
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal("Failed to create file: ", err)
+	}
+	defer outputFile.Close()
+
+	if err := WriteTMX(outputFile, mapData, filepath.Base(tilesetFilename)); err != nil {
+		log.Fatal("Error writing to ", outputFilename, ": ", err)
+	}
+}
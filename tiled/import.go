@@ -0,0 +1,380 @@
+package tiled
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// Tiled stores flipped tiles in the high bits of the gid
+const gidFlags = 0xf0000000
+
+func intPropertyValue(properties []tmxProperty, name string, defaultValue int) (int, error) {
+	value, ok := findProperty(properties, name)
+	if !ok {
+		return defaultValue, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("property %s: %q is not a number", name, value)
+	}
+	return number, nil
+}
+
+// decodeLayerData returns the gids of a tile layer in any of the encodings Tiled can save.
+func decodeLayerData(data tmxData, count int) ([]uint32, error) {
+	gids := make([]uint32, 0, count)
+	switch data.Encoding {
+	case "csv":
+		for _, field := range strings.Split(data.Text, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tile %q", field)
+			}
+			gids = append(gids, uint32(gid))
+		}
+	case "base64":
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data.Text))
+		if err != nil {
+			return nil, err
+		}
+		var reader io.Reader = bytes.NewReader(raw)
+		switch data.Compression {
+		case "":
+		case "zlib":
+			if reader, err = zlib.NewReader(reader); err != nil {
+				return nil, err
+			}
+		case "gzip":
+			if reader, err = gzip.NewReader(reader); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression %s", data.Compression)
+		}
+		raw, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+4 <= len(raw); i += 4 {
+			gids = append(gids, binary.LittleEndian.Uint32(raw[i:]))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q, save the layer as csv or base64", data.Encoding)
+	}
+	if len(gids) != count {
+		return nil, fmt.Errorf("expected %d tiles, got %d", count, len(gids))
+	}
+	return gids, nil
+}
+
+// tilesetTerrains maps the gids of the terrain tileset to terrains
+func tilesetTerrains(tilesets []tmxTileset) map[uint32]fileio.Terrain {
+	terrains := make(map[uint32]fileio.Terrain)
+	for _, tileset := range tilesets {
+		if tileset.Name != terrainLayerName {
+			continue
+		}
+		for i, terrain := range fileio.AllTerrains {
+			terrains[uint32(tileset.FirstGid+i)] = terrain
+		}
+		// Tile properties win over the order, in case the tileset was edited
+		for _, tile := range tileset.Tiles {
+			if value, ok := findProperty(tile.Properties, terrainProperty); ok {
+				terrains[uint32(tileset.FirstGid+tile.Id)] = fileio.Terrain(value)
+			}
+		}
+	}
+	return terrains
+}
+
+func decompressTiles(value string, width int, height int, tileSize int) (*fileio.TileGrid, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	slab, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return fileio.NewTileGridFromBytes(width, height, tileSize, slab)
+}
+
+func objectGroup(tmx *tmxMap, name string) []tmxObject {
+	for _, group := range tmx.ObjectGroups {
+		if group.Name == name {
+			return group.Objects
+		}
+	}
+	return nil
+}
+
+func unitJsonFromObject(object tmxObject, onMap bool) (fileio.UnitJson, error) {
+	unitJson := fileio.UnitJson{Name: object.Name}
+	ints := []struct {
+		name         string
+		value        *int
+		defaultValue int
+	}{
+		{indexProperty, &unitJson.Index, -1},
+		{colorGroupProperty, &unitJson.ColorGroup, 0},
+		{unitTypeProperty, &unitJson.Type, 0},
+	}
+	for _, v := range ints {
+		value, err := intPropertyValue(object.Properties, v.name, v.defaultValue)
+		if err != nil {
+			return unitJson, err
+		}
+		*v.value = value
+	}
+	stats := []struct {
+		name  string
+		value *uint32
+	}{
+		{proficiencyProperty, &unitJson.Proficiency},
+		{readinessProperty, &unitJson.Readiness},
+		{supplyLevelProperty, &unitJson.SupplyLevel},
+	}
+	for _, v := range stats {
+		value, err := intPropertyValue(object.Properties, v.name, 0)
+		if err != nil {
+			return unitJson, err
+		}
+		*v.value = uint32(value)
+	}
+	if _, ok := findProperty(object.Properties, nextUnitProperty); ok {
+		next, err := intPropertyValue(object.Properties, nextUnitProperty, 0)
+		if err != nil {
+			return unitJson, err
+		}
+		unitJson.NextUnitOnSameTile = &next
+	}
+	if onMap {
+		x, y := nearestHex(object.X, object.Y)
+		unitJson.X, unitJson.Y = &x, &y
+	}
+	return unitJson, nil
+}
+
+func (tmx *tmxMap) checkPosition(x int, y int) error {
+	if x < 0 || y < 0 || x >= tmx.Width || y >= tmx.Height {
+		return fmt.Errorf("position %d,%d is outside the map", x, y)
+	}
+	return nil
+}
+
+// nextFreeSlot returns the first index that isn't used, for objects added in Tiled
+func nextFreeSlot(used map[int]bool) int {
+	index := 0
+	for used[index] {
+		index++
+	}
+	used[index] = true
+	return index
+}
+
+// toMapJson converts everything except the terrain layer to the version 2 json format,
+// which checks the tables when it is converted to map data.
+func (tmx *tmxMap) toMapJson() (*fileio.TOAWMapJsonV2, error) {
+	if tmx.Orientation != "hexagonal" || tmx.StaggerAxis != "x" || tmx.StaggerIndex != "even" {
+		return nil, fmt.Errorf("expected a hexagonal map with stagger axis x and stagger index even")
+	}
+	if tmx.Width < 1 || tmx.Height < 1 {
+		return nil, fmt.Errorf("invalid map size %dx%d", tmx.Width, tmx.Height)
+	}
+
+	mapJson := &fileio.TOAWMapJsonV2{
+		SchemaVersion: fileio.JsonSchemaVersion,
+		GameName:      "TOAW",
+		FileFormat:    "TOAW map scenario",
+		Map:           fileio.MapInfoJson{Width: tmx.Width, Height: tmx.Height},
+	}
+	version, err := intPropertyValue(tmx.Properties, versionProperty, 0)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := findProperty(tmx.Properties, metadataProperty); ok {
+		if err := json.Unmarshal([]byte(value), &mapJson.Metadata); err != nil {
+			return nil, fmt.Errorf("property %s: %w", metadataProperty, err)
+		}
+	}
+	mapJson.Metadata.Version = version
+	if value, ok := findProperty(tmx.Properties, teamsProperty); ok {
+		if err := json.Unmarshal([]byte(value), &mapJson.Teams); err != nil {
+			return nil, fmt.Errorf("property %s: %w", teamsProperty, err)
+		}
+	}
+
+	// Maps made in Tiled have TOAW4 sized tiles
+	if mapJson.Map.TileSize, err = intPropertyValue(tmx.Properties, tileSizeProperty, 48); err != nil {
+		return nil, err
+	}
+	if mapJson.Map.TileSize != 47 && mapJson.Map.TileSize != 48 {
+		return nil, fmt.Errorf("property %s: tiles must be 47 or 48 bytes, got %d", tileSizeProperty, mapJson.Map.TileSize)
+	}
+	allTileData := fileio.NewTileGrid(tmx.Width, tmx.Height, mapJson.Map.TileSize)
+	if value, ok := findProperty(tmx.Properties, tilesProperty); ok {
+		allTileData, err = decompressTiles(value, tmx.Width, tmx.Height, mapJson.Map.TileSize)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", tilesProperty, err)
+		}
+	}
+	for y := 0; y < tmx.Height; y++ {
+		mapJson.Tiles = append(mapJson.Tiles, fileio.TileRowJson{Y: y, Raw: allTileData.Row(y, nil)})
+	}
+
+	usedLocations := make(map[int]bool)
+	for _, object := range objectGroup(tmx, locationsLayerName) {
+		index, err := intPropertyValue(object.Properties, indexProperty, -1)
+		if err != nil {
+			return nil, fmt.Errorf("location %s: %w", object.Name, err)
+		}
+		x, y := nearestHex(object.X, object.Y)
+		if err := tmx.checkPosition(x, y); err != nil {
+			return nil, fmt.Errorf("location %s: %w", object.Name, err)
+		}
+		mapJson.Locations = append(mapJson.Locations, fileio.LocationJson{Index: index, Name: object.Name, X: x, Y: y})
+		if index >= 0 {
+			usedLocations[index] = true
+		}
+	}
+	for i := range mapJson.Locations {
+		if mapJson.Locations[i].Index < 0 {
+			mapJson.Locations[i].Index = nextFreeSlot(usedLocations)
+		}
+	}
+
+	usedUnits := make(map[int]bool)
+	for _, layer := range []string{unitsLayerName, offMapUnitsLayerName} {
+		for _, object := range objectGroup(tmx, layer) {
+			unitJson, err := unitJsonFromObject(object, layer == unitsLayerName)
+			if err != nil {
+				return nil, fmt.Errorf("unit %s: %w", object.Name, err)
+			}
+			if unitJson.X != nil {
+				if err := tmx.checkPosition(*unitJson.X, *unitJson.Y); err != nil {
+					return nil, fmt.Errorf("unit %s: %w", object.Name, err)
+				}
+			}
+			mapJson.Units = append(mapJson.Units, unitJson)
+			if unitJson.Index >= 0 {
+				usedUnits[unitJson.Index] = true
+			}
+		}
+	}
+	for i := range mapJson.Units {
+		if mapJson.Units[i].Index < 0 {
+			mapJson.Units[i].Index = nextFreeSlot(usedUnits)
+		}
+	}
+
+	// The tables grow to fit objects that were added in Tiled
+	if mapJson.Map.LocationSlots, err = intPropertyValue(tmx.Properties, locationSlotsProperty, 0); err != nil {
+		return nil, err
+	}
+	for _, locationJson := range mapJson.Locations {
+		if locationJson.Index >= mapJson.Map.LocationSlots {
+			mapJson.Map.LocationSlots = locationJson.Index + 1
+		}
+	}
+	if mapJson.Map.UnitSlots, err = intPropertyValue(tmx.Properties, unitSlotsProperty, 0); err != nil {
+		return nil, err
+	}
+	for _, unitJson := range mapJson.Units {
+		if unitJson.Index >= mapJson.Map.UnitSlots {
+			mapJson.Map.UnitSlots = unitJson.Index + 1
+		}
+	}
+	return mapJson, nil
+}
+
+// applyTerrainLayer changes the terrain of the tiles that were painted over in Tiled.
+// Tiles that still have their original terrain are left alone, so their other flags don't change.
+func (tmx *tmxMap) applyTerrainLayer(allTileData *fileio.TileGrid) error {
+	for _, layer := range tmx.Layers {
+		if layer.Name != terrainLayerName {
+			continue
+		}
+		gids, err := decodeLayerData(layer.Data, tmx.Width*tmx.Height)
+		if err != nil {
+			return fmt.Errorf("layer %s: %w", layer.Name, err)
+		}
+		terrains := tilesetTerrains(tmx.Tilesets)
+		for i, gid := range gids {
+			gid &^= gidFlags
+			if gid == 0 {
+				continue
+			}
+			terrain, ok := terrains[gid]
+			if !ok {
+				return fmt.Errorf("layer %s: tile %d at %d,%d is not a terrain", layer.Name, gid, i%tmx.Width, i/tmx.Width)
+			}
+			tileData := allTileData.At(i%tmx.Width, i/tmx.Width)
+			if tileData.Terrain() != terrain {
+				tileData.SetTerrain(terrain)
+			}
+		}
+	}
+	return nil
+}
+
+// ReadTMX reads a map written by WriteTMX and edited in Tiled. Locations and units
+// are placed on the hex nearest to their object, and objects without an index
+// property are added to free slots.
+func ReadTMX(r io.Reader) (*fileio.TOAWMapData, error) {
+	tmx := &tmxMap{}
+	if err := xml.NewDecoder(r).Decode(tmx); err != nil {
+		return nil, err
+	}
+	mapJson, err := tmx.toMapJson()
+	if err != nil {
+		return nil, err
+	}
+	// The objects and properties may have been edited by hand, so they get the same
+	// checks as an imported json file
+	if err := mapJson.Validate(); err != nil {
+		return nil, err
+	}
+	mapData, err := mapJson.ToMapData()
+	if err != nil {
+		return nil, err
+	}
+	if err := tmx.applyTerrainLayer(mapData.AllTileData); err != nil {
+		return nil, err
+	}
+	return mapData, nil
+}
+
+// ImportTMX reads a TMX file.
+func ImportTMX(filename string) (*fileio.TOAWMapData, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mapData, err := ReadTMX(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return mapData, nil
+}
@@ -0,0 +1,173 @@
+package tiled
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/samuelyuan/TOAWMap/fileio"
+)
+
+// writeTestTMX writes a small map with a stack of two units and a unit off the map.
+func writeTestTMX(t *testing.T) string {
+	t.Helper()
+	allUnitData := make([]*fileio.UnitData, 3)
+	for i := range allUnitData {
+		allUnitData[i] = &fileio.UnitData{X: 1, Y: 1, UnitIndex: uint32(i), OtherUnitIndexOnSameTile: 1000}
+		copy(allUnitData[i].Name[:], "Unit")
+	}
+	allUnitData[0].OtherUnitIndexOnSameTile = 1
+	allUnitData[2].X, allUnitData[2].Y = fileio.OffMapCoordinate, fileio.OffMapCoordinate
+	mapData := &fileio.TOAWMapData{Version: 4, AllTileData: fileio.NewTileGrid(4, 3, 48), AllUnitData: allUnitData, MapWidth: 4, MapHeight: 3}
+
+	var buf bytes.Buffer
+	if err := WriteTMX(&buf, mapData, "map_terrain.png"); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestReadTMX(t *testing.T) {
+	mapData, err := ReadTMX(strings.NewReader(writeTestTMX(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapData.AllUnitData) != 3 || mapData.AllUnitData[0].OtherUnitIndexOnSameTile != 1 {
+		t.Error("the units changed after a round trip")
+	}
+}
+
+// Edited objects get the same checks as an imported json file.
+func TestReadTMXValidates(t *testing.T) {
+	tmx := writeTestTMX(t)
+	for _, test := range []struct {
+		name string
+		old  string
+		new  string
+		path string
+	}{
+		{"next unit outside the table", `name="nextUnitOnSameTile" type="int" value="1"`, `name="nextUnitOnSameTile" type="int" value="7"`, "units[0].nextUnitOnSameTile"},
+		{"duplicate unit index", `name="index" type="int" value="1"`, `name="index" type="int" value="0"`, "units[1].index"},
+	} {
+		if !strings.Contains(tmx, test.old) {
+			t.Fatalf("%s: the map has no %s", test.name, test.old)
+		}
+		_, err := ReadTMX(strings.NewReader(strings.Replace(tmx, test.old, test.new, 1)))
+		var validationErrors fileio.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			t.Errorf("%s: expected validation errors, found %v", test.name, err)
+			continue
+		}
+		if validationErrors[0].Path != test.path {
+			t.Errorf("%s: the problem is at %s, expected %s", test.name, validationErrors[0].Path, test.path)
+		}
+	}
+}
+
+// Painting the terrain layer and moving objects in Tiled changes the map.
+func TestReadTMXEdits(t *testing.T) {
+	allTileData := fileio.NewTileGrid(4, 3, 48)
+	sand := allTileData.At(0, 0)
+	sand.SetTerrain(fileio.TerrainSand)
+	sand.SetFeature(fileio.FeatureArid, false)
+	sand.SetFeature(fileio.FeatureBadlands, true)
+	sand.SetRouteMask(fileio.RouteRoad, 0x09)
+	allTileData.At(1, 0).SetFeature(fileio.FeatureCForest, true)
+	location := fileio.LocationData{X: 2, Y: 1}
+	copy(location.Name[:], "Warsaw")
+	unit := &fileio.UnitData{X: 1, Y: 1, OtherUnitIndexOnSameTile: 1}
+	copy(unit.Name[:], "Unit")
+	mapData := &fileio.TOAWMapData{Version: 4, AllTileData: allTileData, AllLocationData: []fileio.LocationData{location},
+		AllUnitData: []*fileio.UnitData{unit}, MapWidth: 4, MapHeight: 3}
+	original := append([]byte(nil), allTileData.Bytes()...)
+
+	tmx, err := newTmxMap(mapData, "map_terrain.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gids, err := decodeLayerData(tmx.Layers[0].Data, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gid := func(terrain fileio.Terrain) uint32 {
+		for gid, tilesetTerrain := range tilesetTerrains(tmx.Tilesets) {
+			if tilesetTerrain == terrain {
+				return gid
+			}
+		}
+		t.Fatalf("the tileset has no %s", terrain)
+		return 0
+	}
+	painted := map[[2]int]fileio.Terrain{
+		{1, 0}: fileio.TerrainHills,
+		{2, 0}: fileio.TerrainDeepWater,
+		{3, 2}: fileio.TerrainEmpty,
+	}
+	cells := make([]string, len(gids))
+	for i := range gids {
+		if terrain, ok := painted[[2]int{i % 4, i / 4}]; ok {
+			gids[i] = gid(terrain)
+		}
+		cells[i] = strconv.Itoa(int(gids[i]))
+	}
+	tmx.Layers[0].Data.Text = strings.Join(cells, ",")
+
+	// Objects that are dragged a few pixels off the center stay on their hex,
+	// and objects dragged to another hex move there
+	tmx.ObjectGroups[0].Objects[0].X, tmx.ObjectGroups[0].Objects[0].Y = hexPosition(3, 0)
+	tmx.ObjectGroups[0].Objects[0].X += 5
+	tmx.ObjectGroups[0].Objects[0].Y -= 6
+	tmx.ObjectGroups[1].Objects[0].X -= 7
+	tmx.ObjectGroups[1].Objects[0].Y += 4
+
+	data, err := xml.Marshal(tmx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ReadTMX(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported.AllTileData.Each(func(x int, y int, tileData fileio.TileData) {
+		terrain, ok := painted[[2]int{x, y}]
+		if !ok {
+			// Tiles that weren't painted keep every byte, like the sand subtype and road
+			offset := (x*3 + y) * 48
+			if !bytes.Equal(tileData.Data, original[offset:offset+48]) {
+				t.Errorf("tile (%d, %d) changed without being painted", x, y)
+			}
+			return
+		}
+		if tileData.Terrain() != terrain {
+			t.Errorf("tile (%d, %d) is %s, expected %s", x, y, tileData.Terrain(), terrain)
+		}
+	})
+	// Painting the terrain keeps the features
+	if !imported.AllTileData.At(1, 0).HasFeature(fileio.FeatureCForest) {
+		t.Error("the forest on tile (1, 0) was lost")
+	}
+
+	if location := imported.AllLocationData[0]; location.X != 3 || location.Y != 0 {
+		t.Errorf("location is at (%d, %d), expected (3, 0)", location.X, location.Y)
+	}
+	if unit := imported.AllUnitData[0]; unit.X != 1 || unit.Y != 1 {
+		t.Errorf("unit is at (%d, %d), expected (1, 1)", unit.X, unit.Y)
+	}
+}
+
+func TestNearestHex(t *testing.T) {
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 3; y++ {
+			px, py := hexPosition(x, y)
+			for _, offset := range [][2]float64{{0, 0}, {6, 5}, {-6, -5}, {8, -10}, {-8, 10}} {
+				if nx, ny := nearestHex(px+offset[0], py+offset[1]); nx != x || ny != y {
+					t.Errorf("(%v, %v) from the center of hex (%d, %d) is on hex (%d, %d)", offset[0], offset[1], x, y, nx, ny)
+				}
+			}
+		}
+	}
+}
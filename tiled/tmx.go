@@ -0,0 +1,155 @@
+/*
+Package tiled converts maps to and from the TMX format of the Tiled map editor.
+
+The map is a hexagonal map with stagger axis x, where the even columns are shifted
+down by half a hex. This matches the renderer, where the odd columns are shifted up.
+*/
+package tiled
+
+import (
+	"encoding/xml"
+	"math"
+)
+
+// Size of the hexes in pixels. The hexes have a flat top, so the tile is as wide as
+// the distance between two opposite corners.
+const (
+	hexSideLength = 16
+	tileWidth     = 2 * hexSideLength
+	tileHeight    = 28
+)
+
+// Names of the layers and properties written by the exporter
+const (
+	terrainLayerName      = "terrain"
+	locationsLayerName    = "locations"
+	unitsLayerName        = "units"
+	offMapUnitsLayerName  = "offmap units"
+	propertyPrefix        = "toaw."
+	versionProperty       = propertyPrefix + "version"
+	tileSizeProperty      = propertyPrefix + "tileSize"
+	locationSlotsProperty = propertyPrefix + "locationSlots"
+	unitSlotsProperty     = propertyPrefix + "unitSlots"
+	metadataProperty      = propertyPrefix + "metadata"
+	teamsProperty         = propertyPrefix + "teams"
+	tilesProperty         = propertyPrefix + "tiles"
+	terrainProperty       = "terrain"
+	indexProperty         = "index"
+	colorGroupProperty    = "colorGroup"
+	unitTypeProperty      = "unitType"
+	proficiencyProperty   = "proficiency"
+	readinessProperty     = "readiness"
+	supplyLevelProperty   = "supplyLevel"
+	nextUnitProperty      = "nextUnitOnSameTile"
+)
+
+type tmxMap struct {
+	XMLName       xml.Name         `xml:"map"`
+	Version       string           `xml:"version,attr"`
+	Orientation   string           `xml:"orientation,attr"`
+	RenderOrder   string           `xml:"renderorder,attr"`
+	Width         int              `xml:"width,attr"`
+	Height        int              `xml:"height,attr"`
+	TileWidth     int              `xml:"tilewidth,attr"`
+	TileHeight    int              `xml:"tileheight,attr"`
+	HexSideLength int              `xml:"hexsidelength,attr"`
+	StaggerAxis   string           `xml:"staggeraxis,attr"`
+	StaggerIndex  string           `xml:"staggerindex,attr"`
+	Infinite      int              `xml:"infinite,attr"`
+	NextLayerId   int              `xml:"nextlayerid,attr"`
+	NextObjectId  int              `xml:"nextobjectid,attr"`
+	Properties    []tmxProperty    `xml:"properties>property"`
+	Tilesets      []tmxTileset     `xml:"tileset"`
+	Layers        []tmxLayer       `xml:"layer"`
+	ObjectGroups  []tmxObjectGroup `xml:"objectgroup"`
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:"value,attr"`
+}
+
+type tmxTileset struct {
+	FirstGid   int       `xml:"firstgid,attr"`
+	Name       string    `xml:"name,attr"`
+	TileWidth  int       `xml:"tilewidth,attr"`
+	TileHeight int       `xml:"tileheight,attr"`
+	TileCount  int       `xml:"tilecount,attr"`
+	Columns    int       `xml:"columns,attr"`
+	Image      tmxImage  `xml:"image"`
+	Tiles      []tmxTile `xml:"tile"`
+}
+
+type tmxImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type tmxTile struct {
+	Id         int           `xml:"id,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+type tmxLayer struct {
+	Id     int     `xml:"id,attr"`
+	Name   string  `xml:"name,attr"`
+	Width  int     `xml:"width,attr"`
+	Height int     `xml:"height,attr"`
+	Data   tmxData `xml:"data"`
+}
+
+type tmxData struct {
+	Encoding    string `xml:"encoding,attr,omitempty"`
+	Compression string `xml:"compression,attr,omitempty"`
+	Text        string `xml:",chardata"`
+}
+
+type tmxObjectGroup struct {
+	Id      int         `xml:"id,attr"`
+	Name    string      `xml:"name,attr"`
+	Visible *int        `xml:"visible,attr"`
+	Objects []tmxObject `xml:"object"`
+}
+
+type tmxObject struct {
+	Id         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Type       string        `xml:"type,attr,omitempty"`
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Point      *struct{}     `xml:"point"`
+}
+
+func findProperty(properties []tmxProperty, name string) (string, bool) {
+	for _, property := range properties {
+		if property.Name == name {
+			return property.Value, true
+		}
+	}
+	return "", false
+}
+
+// hexPosition returns the pixel position of the center of hex (x, y) in the Tiled map.
+func hexPosition(x int, y int) (float64, float64) {
+	px := float64(x*(tileWidth+hexSideLength)/2) + tileWidth/2
+	py := float64(y*tileHeight) + tileHeight/2
+	if x%2 == 0 {
+		py += tileHeight / 2
+	}
+	return px, py
+}
+
+// nearestHex returns the hex with its center closest to a pixel position, so objects
+// that were moved don't have to be placed exactly.
+func nearestHex(px float64, py float64) (int, int) {
+	x := int(math.Round((px - tileWidth/2) / float64((tileWidth+hexSideLength)/2)))
+	offset := float64(tileHeight / 2)
+	if x%2 == 0 {
+		offset += tileHeight / 2
+	}
+	y := int(math.Round((py - offset) / tileHeight))
+	return x, y
+}